@@ -27,6 +27,17 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Enable pgvector for semantic search when the database supports it
+	if cfg.VectorIndex != "memory" {
+		enabled, err := database.EnableVectorSearch(db, cfg.EmbeddingDimensions)
+		if err != nil {
+			log.Fatalf("Failed to enable vector search: %v", err)
+		}
+		if enabled {
+			log.Printf("Vector search using pgvector")
+		}
+	}
+
 	// Create and start server
 	srv := server.New(cfg, db)
 
@@ -34,4 +45,4 @@ func main() {
 	if err := srv.Start(); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
-}
\ No newline at end of file
+}
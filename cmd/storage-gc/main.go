@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"pocketscribe/internal/config"
+	"pocketscribe/internal/database"
+	"pocketscribe/internal/jobs"
+	"pocketscribe/internal/services"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	deleteOrphans := flag.Bool("delete", false, "delete unreferenced files instead of only reporting them")
+	gracePeriod := flag.Duration("grace", cfg.StorageGCGracePeriod, "only collect files older than this")
+	flag.Parse()
+
+	// Initialize database connection
+	db, err := database.NewConnection(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	// Run migrations, so keys saved before artifacts are recorded
+	if err := database.RunMigrations(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	storage, err := services.NewStorage(cfg.StorageBackend, services.S3Config{
+		Endpoint:   cfg.StorageEndpoint,
+		Region:     cfg.StorageRegion,
+		AccessKey:  cfg.StorageAccessKey,
+		SecretKey:  cfg.StorageSecretKey,
+		BucketName: cfg.StorageBucketName,
+	}, cfg.AudioStoragePath, cfg.PublicBaseURL+"/files", cfg.StorageSigningSecret)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	collector := jobs.NewStorageCollector(db, storage, jobs.StorageGCOptions{
+		GracePeriod: *gracePeriod,
+		Delete:      *deleteOrphans,
+	})
+
+	report, err := collector.Collect(context.Background())
+	if err != nil {
+		log.Fatalf("Storage garbage collection failed: %v", err)
+	}
+
+	now := time.Now()
+	for _, file := range report.Orphans {
+		fmt.Printf("%-90s %12d bytes  %s old\n", file.Key, file.Size, now.Sub(file.LastModified).Round(time.Minute))
+	}
+	for _, path := range report.LegacyVideos {
+		fmt.Println(path)
+	}
+	fmt.Println()
+	fmt.Printf("Scanned:       %d files\n", report.Scanned)
+	fmt.Printf("Unreferenced:  %d files, %d bytes (older than %s)\n", len(report.Orphans), report.OrphanBytes, *gracePeriod)
+	fmt.Printf("Legacy videos: %d files, %d bytes in ./uploads/videos\n", len(report.LegacyVideos), report.LegacyVideoBytes)
+	if *deleteOrphans {
+		fmt.Printf("Deleted:       %d files\n", report.Deleted+report.LegacyDeleted)
+	} else if len(report.Orphans) > 0 || len(report.LegacyVideos) > 0 {
+		fmt.Println("Run with -delete to delete them")
+	}
+	fmt.Printf("Temp files:    %d removed\n", report.TempFilesRemoved)
+}
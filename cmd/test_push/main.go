@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -17,43 +18,67 @@ func main() {
 	}
 
 	// Read APNS configuration from environment
-	token := os.Getenv("APNS_TEST_TOKEN")
+	keyPath := os.Getenv("APNS_KEY_PATH")
+	keyID := os.Getenv("APNS_KEY_ID")
+	teamID := os.Getenv("APNS_TEAM_ID")
+	deviceToken := os.Getenv("APNS_DEVICE_TOKEN")
 	bundleID := os.Getenv("APNS_BUNDLE_ID")
 	production := os.Getenv("APNS_PRODUCTION") == "true"
 
 	// Validate required variables
-	if token == "" {
-		log.Fatal("APNS_TEST_TOKEN environment variable is required")
+	if keyPath == "" {
+		log.Fatal("APNS_KEY_PATH environment variable is required")
+	}
+	if keyID == "" {
+		log.Fatal("APNS_KEY_ID environment variable is required")
+	}
+	if teamID == "" {
+		log.Fatal("APNS_TEAM_ID environment variable is required")
+	}
+	if deviceToken == "" {
+		log.Fatal("APNS_DEVICE_TOKEN environment variable is required")
 	}
 	if bundleID == "" {
 		log.Fatal("APNS_BUNDLE_ID environment variable is required")
 	}
 
 	// Create APNS service
-	apnsService := services.NewAPNSService(token, bundleID, production)
+	apnsService, err := services.NewAPNSService(services.APNSConfig{
+		KeyPath:    keyPath,
+		KeyID:      keyID,
+		TeamID:     teamID,
+		BundleID:   bundleID,
+		Production: production,
+		Endpoint:   os.Getenv("APNS_ENDPOINT"),
+	})
+	if err != nil {
+		log.Fatalf("❌ Failed to create APNS service: %v", err)
+	}
 
 	fmt.Println("╔════════════════════════════════════════════════════════════╗")
 	fmt.Println("║         Push Notification Test Tool                       ║")
 	fmt.Println("╚════════════════════════════════════════════════════════════╝")
 	fmt.Println()
 	fmt.Printf("Configuration:\n")
+	fmt.Printf("  Key ID:       %s\n", keyID)
+	fmt.Printf("  Team ID:      %s\n", teamID)
 	fmt.Printf("  Bundle ID:    %s\n", bundleID)
 	fmt.Printf("  Environment:  %s\n", map[bool]string{true: "Production", false: "Sandbox"}[production])
-	fmt.Printf("  Device Token: %s\n", apnsService.GetDeviceToken())
+	fmt.Printf("  Device Token: %s\n", deviceToken)
 	fmt.Println()
 
-	// Check if service was created successfully
-	if apnsService == nil {
-		log.Fatal("❌ Failed to create APNS service. Check your token.")
-	}
-
 	// Send test notification
 	fmt.Println("Sending test push notification...")
 	fmt.Println()
 
-	err := apnsService.SendArticleReadyNotification(
-		12345,
-		"How to Build Great Products",
+	err = apnsService.Notify(
+		context.Background(),
+		services.Recipient{Address: deviceToken},
+		services.NewArticleReadyNotification(services.ArticleNotification{
+			ArticleID: 12345,
+			Title:     "How to Build Great Products",
+			Format:    "audio",
+		}, 1),
 	)
 
 	if err != nil {
@@ -61,7 +86,7 @@ func main() {
 		fmt.Println("❌ Failed to send notification")
 		fmt.Println()
 		fmt.Println("Possible issues:")
-		fmt.Println("  1. Token is invalid or expired")
+		fmt.Println("  1. Key ID or Team ID doesn't match the .p8 key")
 		fmt.Println("  2. Device token is invalid or expired")
 		fmt.Println("  3. Bundle ID doesn't match the app's bundle identifier")
 		fmt.Println()
@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,21 +13,75 @@ type Config struct {
 	DatabaseURL       string
 	Port              string
 	Environment       string
+	PublicBaseURL     string
 	GeminiAPIKey      string
+	LLMProvider       string
+	LLMModelSummarize string
+	LLMModelTitle     string
+	LLMModelChat      string
+	LLMModelThumbnail string
+	LLMModelEmbed     string
 	ElevenLabsAPIKey  string
+	StorageBackend    string
 	AudioStoragePath  string
 	StorageEndpoint   string
-	StoragePublicURL  string
 	StorageRegion     string
 	StorageAccessKey  string
 	StorageSecretKey  string
 	StorageBucketName string
 	SupabaseURL       string
 	SupabaseJWTSecret string
-	APNSTestToken     string
-	APNSDeviceToken   string
+	APNSKeyPath       string
+	APNSKeyID         string
+	APNSTeamID        string
+	APNSEndpoint      string
+	AppURLScheme      string
 	APNSBundleID      string
 	APNSProduction    bool
+
+	VideoSceneConcurrency int
+	VideoMaxDuration      int
+
+	FalWebhookSecret   string
+	FalSweepInterval   time.Duration
+	FalSweepStaleAfter time.Duration
+	FalSceneTimeout    time.Duration
+
+	SummarizeMaxInputTokens int
+	SummarizeChunkTokens    int
+	SummarizeConcurrency    int
+
+	EmbeddingDimensions int
+	EmbedChunkTokens    int
+	VectorIndex         string
+
+	TrashRetention     time.Duration
+	TrashPurgeInterval time.Duration
+
+	StorageURLTTL          time.Duration
+	StorageThumbnailURLTTL time.Duration
+	StorageSigningSecret   string
+
+	MediaCacheMaxAge time.Duration
+
+	StorageGCInterval    time.Duration
+	StorageGCGracePeriod time.Duration
+	StorageGCDelete      bool
+
+	FCMCredentialsFile string
+	FCMProjectID       string
+
+	VAPIDPrivateKey string
+	VAPIDSubject    string
+	WebAppURL       string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	BriefingHour int
 }
 
 func Load() (*Config, error) {
@@ -36,29 +92,101 @@ func Load() (*Config, error) {
 		DatabaseURL:       getEnv("DATABASE_URL", ""),
 		Port:              getEnv("PORT", "8080"),
 		Environment:       getEnv("ENV", "development"),
+		PublicBaseURL:     getEnv("PUBLIC_BASE_URL", ""),
 		GeminiAPIKey:      getEnv("GEMINI_API_KEY", ""),
+		LLMProvider:       getEnv("LLM_PROVIDER", "gemini"),
+		LLMModelSummarize: getEnv("LLM_MODEL_SUMMARIZE", "gemini-2.5-pro"),
+		LLMModelTitle:     getEnv("LLM_MODEL_TITLE", "gemini-2.5-pro"),
+		LLMModelChat:      getEnv("LLM_MODEL_CHAT", "gemini-2.5-pro"),
+		LLMModelThumbnail: getEnv("LLM_MODEL_THUMBNAIL", "gemini-2.5-flash-image"),
+		LLMModelEmbed:     getEnv("LLM_MODEL_EMBED", "gemini-embedding-001"),
 		ElevenLabsAPIKey:  getEnv("ELEVENLABS_API_KEY", ""),
-		AudioStoragePath:  getEnv("AUDIO_STORAGE_PATH", "./storage/audio"),
+		StorageBackend:    getEnv("STORAGE_BACKEND", "s3"),
+		AudioStoragePath:  getEnv("AUDIO_STORAGE_PATH", "./storage"),
 		StorageEndpoint:   getEnv("STORAGE_ENDPOINT", ""),
-		StoragePublicURL:  getEnv("STORAGE_PUBLIC_URL", ""),
 		StorageRegion:     getEnv("STORAGE_REGION", "us-east-1"),
 		StorageAccessKey:  getEnv("STORAGE_ACCESS_KEY", ""),
 		StorageSecretKey:  getEnv("STORAGE_SECRET_KEY", ""),
 		StorageBucketName: getEnv("STORAGE_BUCKET_NAME", "audio"),
 		SupabaseURL:       getEnv("SUPABASE_URL", ""),
 		SupabaseJWTSecret: getEnv("SUPABASE_JWT_SECRET", ""),
-		APNSTestToken:     getEnv("APNS_JWT_TOKEN", ""),
-		APNSDeviceToken:   getEnv("APNS_DEVICE_TOKEN", ""),
+		APNSKeyPath:       getEnv("APNS_KEY_PATH", ""),
+		APNSKeyID:         getEnv("APNS_KEY_ID", ""),
+		APNSTeamID:        getEnv("APNS_TEAM_ID", ""),
+		APNSEndpoint:      getEnv("APNS_ENDPOINT", ""),
+		AppURLScheme:      getEnv("APP_URL_SCHEME", "pocketscribe"),
 		APNSBundleID:      getEnv("APNS_BUNDLE_ID", ""),
 		APNSProduction:    getEnv("APNS_PRODUCTION", "false") == "true",
+
+		VideoSceneConcurrency: getEnvInt("VIDEO_SCENE_CONCURRENCY", 3),
+		VideoMaxDuration:      getEnvInt("VIDEO_MAX_DURATION", 180),
+
+		FalWebhookSecret:   getEnv("FAL_WEBHOOK_SECRET", ""),
+		FalSweepInterval:   getEnvDuration("FAL_SWEEP_INTERVAL", time.Minute),
+		FalSweepStaleAfter: getEnvDuration("FAL_SWEEP_STALE_AFTER", 5*time.Minute),
+		FalSceneTimeout:    getEnvDuration("FAL_SCENE_TIMEOUT", 30*time.Minute),
+
+		SummarizeMaxInputTokens: getEnvInt("SUMMARIZE_MAX_INPUT_TOKENS", 100000),
+		SummarizeChunkTokens:    getEnvInt("SUMMARIZE_CHUNK_TOKENS", 20000),
+		SummarizeConcurrency:    getEnvInt("SUMMARIZE_CONCURRENCY", 4),
+
+		EmbeddingDimensions: getEnvInt("EMBEDDING_DIMENSIONS", 768),
+		EmbedChunkTokens:    getEnvInt("EMBED_CHUNK_TOKENS", 400),
+		VectorIndex:         getEnv("VECTOR_INDEX", "auto"),
+
+		TrashRetention:     time.Duration(getEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		TrashPurgeInterval: getEnvDuration("TRASH_PURGE_INTERVAL", time.Hour),
+
+		StorageURLTTL:          getEnvDuration("STORAGE_URL_TTL", time.Hour),
+		StorageThumbnailURLTTL: getEnvDuration("STORAGE_THUMBNAIL_URL_TTL", 24*time.Hour),
+		StorageSigningSecret:   getEnv("STORAGE_SIGNING_SECRET", ""),
+
+		MediaCacheMaxAge: getEnvDuration("MEDIA_CACHE_MAX_AGE", time.Hour),
+
+		StorageGCInterval:    getEnvDuration("STORAGE_GC_INTERVAL", 24*time.Hour),
+		StorageGCGracePeriod: getEnvDuration("STORAGE_GC_GRACE_PERIOD", 24*time.Hour),
+		StorageGCDelete:      getEnv("STORAGE_GC_DELETE", "false") == "true",
+
+		FCMCredentialsFile: getEnv("FCM_CREDENTIALS_FILE", ""),
+		FCMProjectID:       getEnv("FCM_PROJECT_ID", ""),
+
+		VAPIDPrivateKey: getEnv("VAPID_PRIVATE_KEY", ""),
+		VAPIDSubject:    getEnv("VAPID_SUBJECT", ""),
+		WebAppURL:       getEnv("WEB_APP_URL", ""),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
+
+		BriefingHour: getEnvInt("BRIEFING_HOUR", 8),
 	}
 
 	if cfg.DatabaseURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL environment variable is required")
 	}
 
-	if cfg.GeminiAPIKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY environment variable is required")
+	switch cfg.LLMProvider {
+	case "gemini":
+		if cfg.GeminiAPIKey == "" {
+			return nil, fmt.Errorf("GEMINI_API_KEY environment variable is required")
+		}
+	case "fake":
+	default:
+		return nil, fmt.Errorf("LLM_PROVIDER must be 'gemini' or 'fake', got %q", cfg.LLMProvider)
+	}
+
+	switch cfg.VectorIndex {
+	case "auto", "pgvector", "memory":
+	default:
+		return nil, fmt.Errorf("VECTOR_INDEX must be 'auto', 'pgvector' or 'memory', got %q", cfg.VectorIndex)
+	}
+
+	switch cfg.StorageBackend {
+	case "s3", "local":
+	default:
+		return nil, fmt.Errorf("STORAGE_BACKEND must be 's3' or 'local', got %q", cfg.StorageBackend)
 	}
 
 	if cfg.ElevenLabsAPIKey == "" {
@@ -69,6 +197,10 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("SUPABASE_JWT_SECRET environment variable is required")
 	}
 
+	if cfg.BriefingHour < 0 || cfg.BriefingHour > 23 {
+		return nil, fmt.Errorf("BRIEFING_HOUR must be between 0 and 23, got %d", cfg.BriefingHour)
+	}
+
 	return cfg, nil
 }
 
@@ -79,3 +211,19 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"log"
 
 	_ "github.com/lib/pq"
 )
@@ -52,6 +53,224 @@ func RunMigrations(db *sql.DB) error {
 		CREATE INDEX IF NOT EXISTS idx_articles_status ON articles(status);
 		CREATE INDEX IF NOT EXISTS idx_articles_user_id ON articles(user_id);
 		CREATE INDEX IF NOT EXISTS idx_articles_format ON articles(format);
+
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS video_stitch_started_at TIMESTAMPTZ;
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS aspect_ratio TEXT NOT NULL DEFAULT '16:9' CHECK (aspect_ratio IN ('16:9', '9:16', '1:1'));
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS resolution TEXT NOT NULL DEFAULT '720p';
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS structured_summary JSONB;
+
+		CREATE TABLE IF NOT EXISTS video_scenes (
+			id BIGSERIAL PRIMARY KEY,
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			scene_index INTEGER NOT NULL,
+			visual_prompt TEXT NOT NULL,
+			narration TEXT NOT NULL,
+			duration_seconds INTEGER NOT NULL,
+			fal_request_id TEXT,
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'submitted', 'completed', 'failed')),
+			video_url TEXT,
+			error_message TEXT,
+			submitted_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			UNIQUE (article_id, scene_index)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_video_scenes_fal_request_id ON video_scenes(fal_request_id);
+		CREATE INDEX IF NOT EXISTS idx_video_scenes_status ON video_scenes(status);
+
+		CREATE TABLE IF NOT EXISTS chat_threads (
+			id BIGSERIAL PRIMARY KEY,
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			user_id UUID NOT NULL REFERENCES auth.users(id),
+			title TEXT,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_chat_threads_article_user ON chat_threads(article_id, user_id);
+
+		CREATE TABLE IF NOT EXISTS chat_messages (
+			id BIGSERIAL PRIMARY KEY,
+			thread_id BIGINT NOT NULL REFERENCES chat_threads(id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK (role IN ('user', 'assistant')),
+			content TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_chat_messages_thread_id ON chat_messages(thread_id);
+
+		ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS citations JSONB;
+		ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS outside_article BOOLEAN NOT NULL DEFAULT false;
+
+		CREATE TABLE IF NOT EXISTS article_chunks (
+			id BIGSERIAL PRIMARY KEY,
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			chunk_index INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			start_offset INTEGER NOT NULL,
+			end_offset INTEGER NOT NULL,
+			embedding REAL[] NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			UNIQUE (article_id, chunk_index)
+		);
+
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(summary, '')), 'B') ||
+			setweight(to_tsvector('simple', left(coalesce(original_content, ''), 200000)), 'C')
+		) STORED;
+
+		CREATE INDEX IF NOT EXISTS idx_articles_search_vector ON articles USING GIN (search_vector);
+		CREATE INDEX IF NOT EXISTS idx_articles_user_created ON articles(user_id, created_at DESC, id DESC);
+
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS auto_tag BOOLEAN NOT NULL DEFAULT false;
+
+		CREATE TABLE IF NOT EXISTS tags (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES auth.users(id),
+			name TEXT NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			UNIQUE (user_id, name)
+		);
+
+		CREATE TABLE IF NOT EXISTS article_tags (
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			tag_id BIGINT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			source TEXT NOT NULL DEFAULT 'user' CHECK (source IN ('user', 'auto')),
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (article_id, tag_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_article_tags_tag_id ON article_tags(tag_id);
+
+		CREATE TABLE IF NOT EXISTS collections (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES auth.users(id),
+			name TEXT NOT NULL,
+			description TEXT,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_collections_user_id ON collections(user_id);
+
+		CREATE TABLE IF NOT EXISTS collection_articles (
+			collection_id BIGINT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			added_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (collection_id, article_id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_collection_articles_article_id ON collection_articles(article_id);
+
+		CREATE TABLE IF NOT EXISTS article_progress (
+			user_id UUID NOT NULL REFERENCES auth.users(id),
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			device_id TEXT NOT NULL,
+			artifact TEXT NOT NULL CHECK (artifact IN ('text', 'audio', 'video')),
+			position DOUBLE PRECISION NOT NULL DEFAULT 0,
+			completed BOOLEAN NOT NULL DEFAULT false,
+			client_updated_at TIMESTAMPTZ NOT NULL,
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (user_id, article_id, device_id, artifact)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_article_progress_article ON article_progress(article_id, artifact, client_updated_at DESC);
+
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS favorited BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE articles ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+		CREATE INDEX IF NOT EXISTS idx_articles_deleted_at ON articles(deleted_at) WHERE deleted_at IS NOT NULL;
+
+		-- Media columns hold storage keys; URLs are signed when articles are read.
+		-- Strip the public bucket or /files/ prefix from URLs saved before.
+		UPDATE articles SET thumbnail_path = regexp_replace(thumbnail_path, '^.*/storage/v1/object/public/[^/]+/|^.*/files/', '')
+		WHERE thumbnail_path ~ '^https?://|^/files/';
+		UPDATE articles SET audio_file_path = regexp_replace(audio_file_path, '^.*/storage/v1/object/public/[^/]+/|^.*/files/', '')
+		WHERE audio_file_path ~ '^https?://|^/files/';
+		UPDATE articles SET video_file_path = regexp_replace(video_file_path, '^.*/storage/v1/object/public/[^/]+/|^.*/files/', '')
+		WHERE video_file_path ~ '^https?://|^/files/';
+
+		-- Every rendition of an article's media, stored under a key derived from
+		-- its content. The article's media columns point at the current one.
+		CREATE TABLE IF NOT EXISTS artifacts (
+			id BIGSERIAL PRIMARY KEY,
+			article_id BIGINT NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL CHECK (kind IN ('audio', 'thumbnail', 'video')),
+			storage_key TEXT NOT NULL,
+			checksum TEXT, -- hex SHA-256; NULL for files stored before artifacts
+			size_bytes BIGINT,
+			mime_type TEXT NOT NULL,
+			duration_seconds DOUBLE PRECISION,
+			params JSONB NOT NULL DEFAULT '{}',
+			is_current BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			UNIQUE (article_id, kind, checksum)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_artifacts_article_id ON artifacts(article_id, kind, created_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_artifacts_storage_key ON artifacts(storage_key);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_artifacts_current ON artifacts(article_id, kind) WHERE is_current;
+
+		-- Record media stored before artifacts as the current rendition
+		INSERT INTO artifacts (article_id, kind, storage_key, mime_type, is_current, created_at)
+		SELECT a.id, media.kind, media.storage_key, media.mime_type, true, COALESCE(a.updated_at, NOW())
+		FROM articles a
+		CROSS JOIN LATERAL (VALUES
+			('audio', a.audio_file_path, 'audio/mpeg'),
+			('thumbnail', a.thumbnail_path, 'image/png'),
+			('video', a.video_file_path, 'video/mp4')
+		) AS media(kind, storage_key, mime_type)
+		WHERE media.storage_key IS NOT NULL AND media.storage_key <> ''
+		AND NOT EXISTS (SELECT 1 FROM artifacts WHERE article_id = a.id AND kind = media.kind);
+
+		-- Devices registered for push notifications. A token belongs to the
+		-- last user who registered it.
+		CREATE TABLE IF NOT EXISTS devices (
+			id BIGSERIAL PRIMARY KEY,
+			user_id UUID NOT NULL REFERENCES auth.users(id),
+			token TEXT NOT NULL UNIQUE,
+			platform TEXT NOT NULL,
+			environment TEXT CHECK (environment IN ('sandbox', 'production')), -- NULL uses APNS_PRODUCTION
+			app_version TEXT,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			updated_at TIMESTAMPTZ DEFAULT NOW()
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_devices_user_id ON devices(user_id);
+
+		-- Devices that don't report their APNs environment use the configured default
+		ALTER TABLE devices ALTER COLUMN environment DROP NOT NULL;
+		ALTER TABLE devices ALTER COLUMN environment DROP DEFAULT;
+
+		-- Devices receive notifications on the channel of their platform: APNs
+		-- tokens, FCM tokens, or Web Push subscriptions whose token is the
+		-- endpoint URL
+		ALTER TABLE devices ADD COLUMN IF NOT EXISTS channel TEXT NOT NULL DEFAULT 'apns';
+		ALTER TABLE devices ADD COLUMN IF NOT EXISTS web_push_p256dh TEXT;
+		ALTER TABLE devices ADD COLUMN IF NOT EXISTS web_push_auth TEXT;
+
+		-- Which channels each notification event is sent on. Users without a
+		-- row for an event and channel get the default.
+		CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+			event TEXT NOT NULL CHECK (event IN ('article_ready', 'article_failed', 'daily_briefing')),
+			channel TEXT NOT NULL CHECK (channel IN ('apns', 'fcm', 'web_push', 'email')),
+			enabled BOOLEAN NOT NULL,
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (user_id, event, channel)
+		);
+
+		-- Daily briefings sent, so each user gets at most one per day
+		CREATE TABLE IF NOT EXISTS daily_briefings (
+			user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+			sent_on DATE NOT NULL,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			PRIMARY KEY (user_id, sent_on)
+		);
 	`
 
 	_, err := db.Exec(query)
@@ -61,3 +280,26 @@ func RunMigrations(db *sql.DB) error {
 
 	return nil
 }
+
+// EnableVectorSearch adds a pgvector column and HNSW index to article_chunks
+// when the vector extension can be installed. It reports whether pgvector is
+// available; without it, search falls back to the pure-Go index over the
+// REAL[] embeddings.
+func EnableVectorSearch(db *sql.DB, dimensions int) (bool, error) {
+	if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS vector`); err != nil {
+		log.Printf("pgvector is not available, using the in-process vector index: %v", err)
+		return false, nil
+	}
+
+	query := fmt.Sprintf(`
+		ALTER TABLE article_chunks ADD COLUMN IF NOT EXISTS embedding_vector vector(%d);
+		CREATE INDEX IF NOT EXISTS idx_article_chunks_embedding_vector
+			ON article_chunks USING hnsw (embedding_vector vector_cosine_ops);
+	`, dimensions)
+
+	if _, err := db.Exec(query); err != nil {
+		return false, fmt.Errorf("error enabling vector search: %w", err)
+	}
+
+	return true, nil
+}
@@ -1,59 +1,97 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"pocketscribe/internal/middleware"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
 type Article struct {
-	ID              int64   `json:"id"`
-	UserID          string  `json:"user_id"`
-	URL             string  `json:"url"`
-	Title           *string `json:"title,omitempty"`
-	Format          string  `json:"format"`
-	Length          string  `json:"length"`
-	Status          string  `json:"status"`
-	ThumbnailPath   *string `json:"thumbnail_path,omitempty"`
-	CreatedAt       string  `json:"created_at"`
-	UpdatedAt       string  `json:"updated_at"`
-	Language        *string `json:"language,omitempty"`
-	Style           *string `json:"style,omitempty"`
-	OriginalContent *string `json:"original_content,omitempty"`
-	Summary         *string `json:"summary,omitempty"`
-	TextBody        *string `json:"text_body,omitempty"`
-	AudioFilePath   *string `json:"audio_file_path,omitempty"`
-	VideoFilePath   *string `json:"video_file_path,omitempty"`
-	DurationSeconds *int    `json:"duration_seconds,omitempty"`
-	ErrorMessage    *string `json:"error_message,omitempty"`
+	ID                int64           `json:"id"`
+	UserID            string          `json:"user_id"`
+	URL               string          `json:"url"`
+	Title             *string         `json:"title,omitempty"`
+	Format            string          `json:"format"`
+	Length            string          `json:"length"`
+	Status            string          `json:"status"`
+	ThumbnailPath     *string         `json:"thumbnail_path,omitempty"`
+	CreatedAt         string          `json:"created_at"`
+	UpdatedAt         string          `json:"updated_at"`
+	Language          *string         `json:"language,omitempty"`
+	Style             *string         `json:"style,omitempty"`
+	AspectRatio       string          `json:"aspect_ratio"`
+	Resolution        string          `json:"resolution"`
+	OriginalContent   *string         `json:"original_content,omitempty"`
+	Summary           *string         `json:"summary,omitempty"`
+	StructuredSummary json.RawMessage `json:"structured_summary,omitempty"`
+	TextBody          *string         `json:"text_body,omitempty"`
+	AudioFilePath     *string         `json:"audio_file_path,omitempty"`
+	VideoFilePath     *string         `json:"video_file_path,omitempty"`
+	DurationSeconds   *int            `json:"duration_seconds,omitempty"`
+	ErrorMessage      *string         `json:"error_message,omitempty"`
+	Archived          bool            `json:"archived"`
+	Favorited         bool            `json:"favorited"`
+	DeletedAt         *string         `json:"deleted_at,omitempty"`
+	Tags              []string        `json:"tags,omitempty"`
+	Progress          json.RawMessage `json:"progress,omitempty"` // latest progress per artifact
 }
 
 type CreateArticleRequest struct {
-	URL      string  `json:"url"`
-	Format   string  `json:"format"`
-	Length   string  `json:"length"`
-	Language *string `json:"language,omitempty"`
-	Style    *string `json:"style,omitempty"`
+	URL         string  `json:"url"`
+	Format      string  `json:"format"`
+	Length      string  `json:"length"`
+	Language    *string `json:"language,omitempty"`
+	Style       *string `json:"style,omitempty"`
+	AspectRatio *string `json:"aspect_ratio,omitempty"`
+	Resolution  *string `json:"resolution,omitempty"`
+
+	CollectionID *int64   `json:"collection_id,omitempty"` // collection to file the article into
+	Tags         []string `json:"tags,omitempty"`
+	AutoTag      *bool    `json:"auto_tag,omitempty"` // let Gemini add tags from the user's existing tags
+}
+
+// UpdateArticleRequest changes an article's lifecycle flags; omitted fields are left unchanged
+type UpdateArticleRequest struct {
+	Archived  *bool `json:"archived,omitempty"`
+	Favorited *bool `json:"favorited,omitempty"`
 }
 
+// supportedAspectRatios are the aspect ratios text and audio articles can be
+// framed for; videos are limited to what the video model renders
+var supportedAspectRatios = []string{"16:9", "9:16", "1:1"}
+
 type ArticleHandler struct {
-	db           *sql.DB
-	jobProcessor JobProcessor
+	db             *sql.DB
+	jobProcessor   JobProcessor
+	videoValidator VideoOutputValidator
+	media          *MediaURLs
 }
 
 type JobProcessor interface {
 	ProcessArticle(articleID int64)
 }
 
-func NewArticleHandler(db *sql.DB, jobProcessor JobProcessor) *ArticleHandler {
+// VideoOutputValidator checks output options against the video provider
+type VideoOutputValidator interface {
+	ValidateVideoOutput(aspectRatio, resolution string) error
+	AspectRatios() []string
+	DefaultResolution() string
+}
+
+func NewArticleHandler(db *sql.DB, jobProcessor JobProcessor, videoValidator VideoOutputValidator, media *MediaURLs) *ArticleHandler {
 	return &ArticleHandler{
-		db:           db,
-		jobProcessor: jobProcessor,
+		db:             db,
+		jobProcessor:   jobProcessor,
+		videoValidator: videoValidator,
+		media:          media,
 	}
 }
 
@@ -71,50 +109,123 @@ func (h *ArticleHandler) CreateArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	article, reqErr := h.createArticle(userID, req)
+	if reqErr != nil {
+		http.Error(w, reqErr.message, reqErr.status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(article)
+}
+
+// requestError is an error with the HTTP status to respond with
+type requestError struct {
+	status  int
+	message string
+}
+
+// createArticle validates and inserts an article, files it into its
+// collection and tags, and queues it for processing
+func (h *ArticleHandler) createArticle(userID string, req CreateArticleRequest) (*Article, *requestError) {
 	// Validate required fields
 	if req.URL == "" {
-		http.Error(w, "URL is required", http.StatusBadRequest)
-		return
+		return nil, &requestError{http.StatusBadRequest, "URL is required"}
 	}
 
 	// Validate format
 	if req.Format != "text" && req.Format != "audio" && req.Format != "video" {
-		http.Error(w, "Format must be 'text', 'audio', or 'video'", http.StatusBadRequest)
-		return
+		return nil, &requestError{http.StatusBadRequest, "Format must be 'text', 'audio', or 'video'"}
 	}
 
 	// Validate length
 	if req.Length != "s" && req.Length != "m" && req.Length != "l" {
-		http.Error(w, "Length must be 's', 'm', or 'l'", http.StatusBadRequest)
-		return
+		return nil, &requestError{http.StatusBadRequest, "Length must be 's', 'm', or 'l'"}
+	}
+
+	// Validate aspect ratio (defaults to 16:9)
+	aspectRatio := "16:9"
+	if req.AspectRatio != nil {
+		aspectRatio = *req.AspectRatio
+	}
+	aspectRatios := supportedAspectRatios
+	if req.Format == "video" {
+		aspectRatios = h.videoValidator.AspectRatios()
+	}
+	if !containsString(aspectRatios, aspectRatio) {
+		return nil, &requestError{http.StatusBadRequest, "Aspect ratio must be one of: " + strings.Join(aspectRatios, ", ")}
+	}
+
+	// Validate resolution against the video provider
+	resolution := h.videoValidator.DefaultResolution()
+	if req.Resolution != nil {
+		resolution = *req.Resolution
+	}
+	if req.Format == "video" {
+		if err := h.videoValidator.ValidateVideoOutput(aspectRatio, resolution); err != nil {
+			return nil, &requestError{http.StatusBadRequest, err.Error()}
+		}
+	}
+
+	// Validate tags
+	tags, err := normalizeTagNames(req.Tags)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, err.Error()}
 	}
 
+	autoTag := req.AutoTag != nil && *req.AutoTag
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, &requestError{http.StatusInternalServerError, "Failed to create article"}
+	}
+	defer tx.Rollback()
+
 	// Insert article with status 'queued' and user_id
 	var article Article
-	query := `INSERT INTO articles (user_id, url, format, length, language, style, status)
-	          VALUES ($1, $2, $3, $4, $5, $6, 'queued')
+	query := `INSERT INTO articles (user_id, url, format, length, language, style, aspect_ratio, resolution, auto_tag, status)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'queued')
 	          RETURNING id, user_id, url, title, format, length, status, thumbnail_path,
-	                    created_at, updated_at, language, style`
+	                    created_at, updated_at, language, style, aspect_ratio, resolution`
 
-	err := h.db.QueryRow(query, userID, req.URL, req.Format, req.Length, req.Language, req.Style).Scan(
+	err = tx.QueryRow(query, userID, req.URL, req.Format, req.Length, req.Language, req.Style, aspectRatio, resolution, autoTag).Scan(
 		&article.ID, &article.UserID, &article.URL, &article.Title, &article.Format, &article.Length,
 		&article.Status, &article.ThumbnailPath, &article.CreatedAt, &article.UpdatedAt,
-		&article.Language, &article.Style,
+		&article.Language, &article.Style, &article.AspectRatio, &article.Resolution,
 	)
 	if err != nil {
-		http.Error(w, "Failed to create article", http.StatusInternalServerError)
-		return
+		return nil, &requestError{http.StatusInternalServerError, "Failed to create article"}
+	}
+
+	// File the article into its collection
+	if req.CollectionID != nil {
+		added, err := addToCollection(tx, *req.CollectionID, userID, article.ID)
+		if err != nil {
+			return nil, &requestError{http.StatusInternalServerError, "Failed to add article to collection"}
+		}
+		if !added {
+			return nil, &requestError{http.StatusNotFound, "Collection not found"}
+		}
+	}
+
+	// Tag the article
+	if err := setArticleTags(tx, userID, article.ID, tags); err != nil {
+		return nil, &requestError{http.StatusInternalServerError, "Failed to tag article"}
+	}
+	article.Tags = tags
+
+	if err := tx.Commit(); err != nil {
+		return nil, &requestError{http.StatusInternalServerError, "Failed to create article"}
 	}
 
 	// Trigger background processing
 	go h.jobProcessor.ProcessArticle(article.ID)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(article)
+	return &article, nil
 }
 
-func (h *ArticleHandler) GetArticles(w http.ResponseWriter, r *http.Request) {
+func (h *ArticleHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -122,35 +233,61 @@ func (h *ArticleHandler) GetArticles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := h.db.Query(`SELECT id, user_id, url, title, format, length, status, thumbnail_path,
-	                         created_at, updated_at, language, style, summary, text_body,
-	                         audio_file_path, video_file_path, duration_seconds, error_message
-	                         FROM articles WHERE user_id = $1 ORDER BY created_at DESC`, userID)
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	articles := []Article{}
-	for rows.Next() {
-		var article Article
-		if err := rows.Scan(&article.ID, &article.UserID, &article.URL, &article.Title,
-			&article.Format, &article.Length, &article.Status, &article.ThumbnailPath,
-			&article.CreatedAt, &article.UpdatedAt, &article.Language, &article.Style,
-			&article.Summary, &article.TextBody, &article.AudioFilePath, &article.VideoFilePath,
-			&article.DurationSeconds, &article.ErrorMessage); err != nil {
-			http.Error(w, "Failed to scan article", http.StatusInternalServerError)
-			return
-		}
-		articles = append(articles, article)
+	article, err := h.getArticle(r.Context(), int64(id), userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(articles)
+	json.NewEncoder(w).Encode(article)
 }
 
-func (h *ArticleHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
+// getArticle loads one of the user's articles that is not in the trash, with
+// freshly signed media URLs
+func (h *ArticleHandler) getArticle(ctx context.Context, id int64, userID string) (*Article, error) {
+	var article Article
+	query := `SELECT id, user_id, url, title, format, length, status, thumbnail_path,
+	          created_at, updated_at, language, style, aspect_ratio, resolution, original_content, summary,
+	          structured_summary, text_body, audio_file_path, video_file_path, duration_seconds, error_message,
+	          archived, favorited, ` + articleTagsColumn + `, ` + articleProgressColumn + `
+	          FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+
+	var structuredSummary []byte
+	err := h.db.QueryRow(query, id, userID).Scan(
+		&article.ID, &article.UserID, &article.URL, &article.Title, &article.Format, &article.Length,
+		&article.Status, &article.ThumbnailPath, &article.CreatedAt, &article.UpdatedAt,
+		&article.Language, &article.Style, &article.AspectRatio, &article.Resolution,
+		&article.OriginalContent, &article.Summary, &structuredSummary, &article.TextBody,
+		&article.AudioFilePath, &article.VideoFilePath, &article.DurationSeconds, &article.ErrorMessage,
+		&article.Archived, &article.Favorited,
+		(*pq.StringArray)(&article.Tags), (*[]byte)(&article.Progress),
+	)
+	if err != nil {
+		return nil, err
+	}
+	article.StructuredSummary = structuredSummary
+
+	if err := h.media.signArticle(ctx, &article); err != nil {
+		return nil, err
+	}
+
+	return &article, nil
+}
+
+// UpdateArticle archives, unarchives, favorites or unfavorites an article
+func (h *ArticleHandler) UpdateArticle(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -165,22 +302,28 @@ func (h *ArticleHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var article Article
-	query := `SELECT id, user_id, url, title, format, length, status, thumbnail_path,
-	          created_at, updated_at, language, style, original_content, summary, text_body,
-	          audio_file_path, video_file_path, duration_seconds, error_message
-	          FROM articles WHERE id = $1 AND user_id = $2`
+	var req UpdateArticleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
-	err = h.db.QueryRow(query, id, userID).Scan(
-		&article.ID, &article.UserID, &article.URL, &article.Title, &article.Format, &article.Length,
-		&article.Status, &article.ThumbnailPath, &article.CreatedAt, &article.UpdatedAt,
-		&article.Language, &article.Style, &article.OriginalContent, &article.Summary, &article.TextBody,
-		&article.AudioFilePath, &article.VideoFilePath, &article.DurationSeconds, &article.ErrorMessage,
-	)
-	if err == sql.ErrNoRows {
+	query := `UPDATE articles
+	          SET archived = COALESCE($1, archived), favorited = COALESCE($2, favorited), updated_at = CURRENT_TIMESTAMP
+	          WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL`
+	result, err := h.db.Exec(query, req.Archived, req.Favorited, id, userID)
+	if err != nil {
+		http.Error(w, "Failed to update article", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
 		http.Error(w, "Article not found", http.StatusNotFound)
 		return
 	}
+
+	article, err := h.getArticle(r.Context(), int64(id), userID)
 	if err != nil {
 		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
 		return
@@ -190,6 +333,8 @@ func (h *ArticleHandler) GetArticle(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(article)
 }
 
+// DeleteArticle moves an article to the trash. It can be restored until the
+// trash purger removes it and its files.
 func (h *ArticleHandler) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
 	userID, ok := middleware.GetUserID(r)
@@ -205,7 +350,9 @@ func (h *ArticleHandler) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec(`DELETE FROM articles WHERE id = $1 AND user_id = $2`, id, userID)
+	query := `UPDATE articles SET deleted_at = NOW()
+	          WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
+	result, err := h.db.Exec(query, id, userID)
 	if err != nil {
 		http.Error(w, "Failed to delete article", http.StatusInternalServerError)
 		return
@@ -219,3 +366,12 @@ func (h *ArticleHandler) DeleteArticle(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pocketscribe/internal/middleware"
+
+	"github.com/lib/pq"
+)
+
+// Page sizes for GetArticles
+const (
+	defaultArticlePageSize = 50
+	maxArticlePageSize     = 100
+)
+
+// ArticleList is a page of articles. NextCursor is set when there are more.
+type ArticleList struct {
+	Articles   []interface{} `json:"articles"`
+	NextCursor *string       `json:"next_cursor"`
+}
+
+// articleField maps a selectable field of Article onto its column
+type articleField struct {
+	name   string
+	column string
+	dest   func(a *Article) interface{}
+}
+
+// articleFields are the fields GetArticles can return, in output order
+var articleFields = []articleField{
+	{"id", "id", func(a *Article) interface{} { return &a.ID }},
+	{"user_id", "user_id", func(a *Article) interface{} { return &a.UserID }},
+	{"url", "url", func(a *Article) interface{} { return &a.URL }},
+	{"title", "title", func(a *Article) interface{} { return &a.Title }},
+	{"format", "format", func(a *Article) interface{} { return &a.Format }},
+	{"length", "length", func(a *Article) interface{} { return &a.Length }},
+	{"status", "status", func(a *Article) interface{} { return &a.Status }},
+	{"thumbnail_path", "thumbnail_path", func(a *Article) interface{} { return &a.ThumbnailPath }},
+	{"created_at", "created_at", func(a *Article) interface{} { return &a.CreatedAt }},
+	{"updated_at", "updated_at", func(a *Article) interface{} { return &a.UpdatedAt }},
+	{"language", "language", func(a *Article) interface{} { return &a.Language }},
+	{"style", "style", func(a *Article) interface{} { return &a.Style }},
+	{"aspect_ratio", "aspect_ratio", func(a *Article) interface{} { return &a.AspectRatio }},
+	{"resolution", "resolution", func(a *Article) interface{} { return &a.Resolution }},
+	{"original_content", "original_content", func(a *Article) interface{} { return &a.OriginalContent }},
+	{"summary", "summary", func(a *Article) interface{} { return &a.Summary }},
+	{"structured_summary", "structured_summary", func(a *Article) interface{} { return (*[]byte)(&a.StructuredSummary) }},
+	{"text_body", "text_body", func(a *Article) interface{} { return &a.TextBody }},
+	{"audio_file_path", "audio_file_path", func(a *Article) interface{} { return &a.AudioFilePath }},
+	{"video_file_path", "video_file_path", func(a *Article) interface{} { return &a.VideoFilePath }},
+	{"duration_seconds", "duration_seconds", func(a *Article) interface{} { return &a.DurationSeconds }},
+	{"error_message", "error_message", func(a *Article) interface{} { return &a.ErrorMessage }},
+	{"archived", "archived", func(a *Article) interface{} { return &a.Archived }},
+	{"favorited", "favorited", func(a *Article) interface{} { return &a.Favorited }},
+	{"tags", articleTagsColumn, func(a *Article) interface{} { return (*pq.StringArray)(&a.Tags) }},
+	{"progress", articleProgressColumn, func(a *Article) interface{} { return (*[]byte)(&a.Progress) }},
+}
+
+// defaultArticleFields are returned when the fields parameter is omitted;
+// original_content and structured_summary are only returned on request
+var defaultArticleFields = []string{
+	"id", "user_id", "url", "title", "format", "length", "status", "thumbnail_path",
+	"created_at", "updated_at", "language", "style", "aspect_ratio", "resolution", "summary", "text_body",
+	"audio_file_path", "video_file_path", "duration_seconds", "error_message", "archived", "favorited",
+	"tags", "progress",
+}
+
+// articleCursor is the position after the last article of a page
+type articleCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        int64     `json:"i"`
+}
+
+func encodeArticleCursor(cursor articleCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeArticleCursor(value string) (articleCursor, error) {
+	var cursor articleCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// GetArticles lists the user's articles, newest first. It supports full-text
+// search, filters, sparse field selection and cursor pagination.
+func (h *ArticleHandler) GetArticles(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+
+	// Select only the requested fields
+	fieldNames := defaultArticleFields
+	sparse := false
+	if value := params.Get("fields"); value != "" {
+		fieldNames = strings.Split(value, ",")
+		sparse = true
+	}
+
+	var fields []articleField
+	requested := make(map[string]bool)
+	for _, name := range fieldNames {
+		name = strings.TrimSpace(name)
+		field, ok := findArticleField(name)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown field '%s'", name), http.StatusBadRequest)
+			return
+		}
+		if !requested[name] {
+			requested[name] = true
+			fields = append(fields, field)
+		}
+	}
+
+	// The cursor needs created_at and id even when they are not returned
+	var cursorCreatedAt time.Time
+	columns := []string{"id", "created_at"}
+	for _, field := range fields {
+		columns = append(columns, field.column)
+	}
+
+	conditions := []string{"user_id = $1", "deleted_at IS NULL"}
+	args := []interface{}{userID}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if q := strings.TrimSpace(params.Get("q")); q != "" {
+		addCondition("search_vector @@ websearch_to_tsquery('simple', $%d)", q)
+	}
+	if status := params.Get("status"); status != "" {
+		addCondition("status = $%d", status)
+	}
+	if format := params.Get("format"); format != "" {
+		addCondition("format = $%d", format)
+	}
+	if language := params.Get("language"); language != "" {
+		addCondition("language = $%d", language)
+	}
+	if tag := params.Get("tag"); tag != "" {
+		addCondition(`EXISTS (SELECT 1 FROM article_tags at JOIN tags t ON t.id = at.tag_id
+		              WHERE at.article_id = articles.id AND t.name = $%d)`, normalizeTagName(tag))
+	}
+	for _, flag := range []string{"archived", "favorited"} {
+		value := params.Get(flag)
+		if value == "" {
+			continue
+		}
+		set, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s must be 'true' or 'false'", flag), http.StatusBadRequest)
+			return
+		}
+		addCondition(flag+" = $%d", set)
+	}
+	if value := params.Get("completed"); value != "" {
+		completed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Completed must be 'true' or 'false'", http.StatusBadRequest)
+			return
+		}
+		if completed {
+			conditions = append(conditions, articleCompletedCondition)
+		} else {
+			conditions = append(conditions, "NOT "+articleCompletedCondition)
+		}
+	}
+	if value := params.Get("collection_id"); value != "" {
+		collectionID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+			return
+		}
+		addCondition("id IN (SELECT article_id FROM collection_articles WHERE collection_id = $%d)", collectionID)
+	}
+	for _, bound := range []struct {
+		param     string
+		condition string
+	}{
+		{"created_after", "created_at >= $%d"},
+		{"created_before", "created_at < $%d"},
+	} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s must be an RFC 3339 timestamp", bound.param), http.StatusBadRequest)
+			return
+		}
+		addCondition(bound.condition, t)
+	}
+
+	limit := defaultArticlePageSize
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxArticlePageSize {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d", maxArticlePageSize), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		cursor, err := decodeArticleCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	// Fetch one extra row to know whether there is a next page
+	args = append(args, limit+1)
+	query := fmt.Sprintf(`SELECT %s FROM articles WHERE %s ORDER BY created_at DESC, id DESC LIMIT $%d`,
+		strings.Join(columns, ", "), strings.Join(conditions, " AND "), len(args))
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	list := ArticleList{Articles: []interface{}{}}
+	var last articleCursor
+	for rows.Next() {
+		if len(list.Articles) == limit {
+			next := encodeArticleCursor(last)
+			list.NextCursor = &next
+			break
+		}
+
+		var article Article
+		dests := []interface{}{&last.ID, &cursorCreatedAt}
+		for _, field := range fields {
+			dests = append(dests, field.dest(&article))
+		}
+		if err := rows.Scan(dests...); err != nil {
+			http.Error(w, "Failed to scan article", http.StatusInternalServerError)
+			return
+		}
+		last.CreatedAt = cursorCreatedAt
+
+		if err := h.media.signArticle(r.Context(), &article); err != nil {
+			http.Error(w, "Failed to sign media URLs", http.StatusInternalServerError)
+			return
+		}
+
+		if !sparse {
+			list.Articles = append(list.Articles, article)
+			continue
+		}
+
+		item := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			item[field.name] = field.dest(&article)
+		}
+		if requested["tags"] && article.Tags == nil {
+			item["tags"] = []string{}
+		}
+		if requested["progress"] {
+			item["progress"] = article.Progress
+		}
+		if requested["structured_summary"] {
+			item["structured_summary"] = article.StructuredSummary
+		}
+		list.Articles = append(list.Articles, item)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "Failed to fetch articles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func findArticleField(name string) (articleField, bool) {
+	for _, field := range articleFields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return articleField{}, false
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pocketscribe/internal/middleware"
+	"pocketscribe/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// Artifact is one stored rendition of an article's audio, thumbnail or video
+type Artifact struct {
+	ID              int64           `json:"id"`
+	Kind            string          `json:"kind"`
+	URL             string          `json:"url"`
+	Checksum        *string         `json:"checksum,omitempty"` // hex SHA-256, missing for media stored before artifacts
+	SizeBytes       *int64          `json:"size_bytes,omitempty"`
+	MimeType        string          `json:"mime_type"`
+	DurationSeconds *float64        `json:"duration_seconds,omitempty"`
+	Params          json.RawMessage `json:"params"` // settings the rendition was generated with
+	Current         bool            `json:"current"`
+	CreatedAt       string          `json:"created_at"`
+}
+
+type ArtifactHandler struct {
+	db             *sql.DB
+	artifacts      *services.ArtifactStore
+	articleHandler *ArticleHandler
+}
+
+func NewArtifactHandler(db *sql.DB, artifacts *services.ArtifactStore, articleHandler *ArticleHandler) *ArtifactHandler {
+	return &ArtifactHandler{
+		db:             db,
+		artifacts:      artifacts,
+		articleHandler: articleHandler,
+	}
+}
+
+// GetArtifacts lists every rendition of an article's media, newest first,
+// optionally only those of one kind
+func (h *ArtifactHandler) GetArtifacts(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	kind := r.URL.Query().Get("kind")
+	if _, ok := services.ArtifactColumn(kind); kind != "" && !ok {
+		http.Error(w, "Kind must be audio, thumbnail or video", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`,
+		id, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	query := `SELECT id, kind, storage_key, checksum, size_bytes, mime_type, duration_seconds, params,
+	          is_current, created_at
+	          FROM artifacts
+	          WHERE article_id = $1 AND ($2 = '' OR kind = $2)
+	          ORDER BY created_at DESC, id DESC`
+
+	rows, err := h.db.Query(query, id, kind)
+	if err != nil {
+		http.Error(w, "Failed to fetch artifacts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	artifacts := []Artifact{}
+	for rows.Next() {
+		var artifact Artifact
+		var params []byte
+		err := rows.Scan(&artifact.ID, &artifact.Kind, &artifact.URL, &artifact.Checksum, &artifact.SizeBytes,
+			&artifact.MimeType, &artifact.DurationSeconds, &params, &artifact.Current, &artifact.CreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan artifact", http.StatusInternalServerError)
+			return
+		}
+		artifact.Params = params
+
+		if err := h.articleHandler.media.signKind(r.Context(), artifact.Kind, &artifact.URL); err != nil {
+			http.Error(w, "Failed to sign media URLs", http.StatusInternalServerError)
+			return
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(artifacts)
+}
+
+// SetCurrentArtifact makes a rendition the one the article serves for its
+// kind, and returns the article with its media pointing at it
+func (h *ArtifactHandler) SetCurrentArtifact(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+	artifactID, err := strconv.ParseInt(vars["artifactId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid artifact ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`,
+		id, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	err = h.artifacts.SetCurrent(r.Context(), int64(id), artifactID)
+	if errors.Is(err, services.ErrArtifactNotFound) {
+		http.Error(w, "Artifact not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to set current artifact", http.StatusInternalServerError)
+		return
+	}
+
+	article, err := h.articleHandler.getArticle(r.Context(), int64(id), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
@@ -24,15 +24,24 @@ func NewChatHandler(db *sql.DB, geminiService *services.GeminiService) *ChatHand
 	}
 }
 
+// ChatRequest is a chat message about an article. With a thread ID the
+// history is loaded from the thread and the exchange is saved to it;
+// without one the client supplies the history in ChatHistory, and both are
+// saved to a new thread.
 type ChatRequest struct {
-	ArticleID   int64                     `json:"article_id"`
-	Message     string                    `json:"message"`
-	ChatHistory []services.ChatMessage    `json:"chat_history"`
+	ArticleID   int64                  `json:"article_id"`
+	ThreadID    *int64                 `json:"thread_id,omitempty"`
+	Message     string                 `json:"message"`
+	ChatHistory []services.ChatMessage `json:"chat_history"`
 }
 
 type ChatResponse struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	ID             int64               `json:"id,omitempty"`
+	ThreadID       int64               `json:"thread_id,omitempty"`
+	Role           string              `json:"role"`
+	Content        string              `json:"content"`
+	Citations      []services.Citation `json:"citations"`
+	OutsideArticle bool                `json:"outside_article"`
 }
 
 // ChatWithArticle handles chat requests for a specific article
@@ -68,7 +77,7 @@ func (h *ChatHandler) ChatWithArticle(w http.ResponseWriter, r *http.Request) {
 	// Fetch the article to ensure it exists and belongs to the user
 	var article Article
 	query := `SELECT id, user_id, original_content, summary, status
-	          FROM articles WHERE id = $1 AND user_id = $2`
+	          FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`
 
 	err = h.db.QueryRow(query, articleID, userID).Scan(
 		&article.ID, &article.UserID, &article.OriginalContent, &article.Summary, &article.Status,
@@ -94,10 +103,34 @@ func (h *ChatHandler) ChatWithArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Use the stored thread history when chatting in a thread
+	history := req.ChatHistory
+	if req.ThreadID != nil {
+		if err := h.checkThread(*req.ThreadID, articleID, userID); err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to fetch thread", http.StatusInternalServerError)
+			return
+		}
+
+		history, err = h.loadHistory(*req.ThreadID)
+		if err != nil {
+			http.Error(w, "Failed to fetch thread messages", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Stream the response token by token when the client asks for events
+	if acceptsEventStream(r) {
+		h.streamChat(w, r, articleID, userID, req, *article.OriginalContent, history)
+		return
+	}
+
 	// Generate response using Gemini
 	response, err := h.geminiService.ChatWithArticle(
 		*article.OriginalContent,
-		req.ChatHistory,
+		history,
 		req.Message,
 	)
 	if err != nil {
@@ -105,10 +138,21 @@ func (h *ChatHandler) ChatWithArticle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	chatResponse := ChatResponse{
+		Role:           "assistant",
+		Content:        response.Content,
+		Citations:      response.Citations,
+		OutsideArticle: response.OutsideArticle,
+	}
+
+	// Save the exchange to the thread
+	chatResponse.ThreadID, chatResponse.ID, err = h.saveChat(articleID, userID, req, history, response)
+	if err != nil {
+		http.Error(w, "Failed to save chat messages", http.StatusInternalServerError)
+		return
+	}
+
 	// Return the response
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(ChatResponse{
-		Role:    "assistant",
-		Content: response,
-	})
+	json.NewEncoder(w).Encode(chatResponse)
 }
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"pocketscribe/internal/services"
+)
+
+// ChatChunk is the payload of a "token" event
+type ChatChunk struct {
+	Content string `json:"content"`
+}
+
+// ChatStreamError is the payload of an "error" event
+type ChatStreamError struct {
+	Error string `json:"error"`
+}
+
+// acceptsEventStream reports whether the client asked for server-sent events
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// streamChat streams the reply as server-sent events: a "token" event for each
+// piece of text as it is generated, then a "done" event with the saved message
+// and its thread and citations.
+func (h *ChatHandler) streamChat(w http.ResponseWriter, r *http.Request, articleID int64, userID string, req ChatRequest, articleContent string, history []services.ChatMessage) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	response, err := h.geminiService.ChatWithArticleStream(r.Context(), articleContent, history, req.Message, func(chunk string) error {
+		if err := writeEvent(w, "token", ChatChunk{Content: chunk}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		if r.Context().Err() == nil {
+			log.Printf("Failed to stream chat response for article %d: %v", articleID, err)
+			writeEvent(w, "error", ChatStreamError{Error: "Failed to generate response: " + err.Error()})
+			flusher.Flush()
+		}
+		return
+	}
+
+	chatResponse := ChatResponse{
+		Role:           "assistant",
+		Content:        response.Content,
+		Citations:      response.Citations,
+		OutsideArticle: response.OutsideArticle,
+	}
+
+	// Save the exchange to the thread
+	chatResponse.ThreadID, chatResponse.ID, err = h.saveChat(articleID, userID, req, history, response)
+	if err != nil {
+		log.Printf("Failed to save chat messages for article %d: %v", articleID, err)
+		writeEvent(w, "error", ChatStreamError{Error: "Failed to save chat messages"})
+		flusher.Flush()
+		return
+	}
+
+	writeEvent(w, "done", chatResponse)
+	flusher.Flush()
+}
+
+// writeEvent writes a single server-sent event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pocketscribe/internal/middleware"
+	"pocketscribe/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// ChatThread is a saved conversation about an article
+type ChatThread struct {
+	ID           int64               `json:"id"`
+	ArticleID    int64               `json:"article_id"`
+	Title        *string             `json:"title,omitempty"`
+	MessageCount int                 `json:"message_count"`
+	CreatedAt    string              `json:"created_at"`
+	UpdatedAt    string              `json:"updated_at"`
+	Messages     []ChatThreadMessage `json:"messages,omitempty"`
+}
+
+// ChatThreadMessage is a single saved message in a chat thread
+type ChatThreadMessage struct {
+	ID             int64               `json:"id"`
+	Role           string              `json:"role"`
+	Content        string              `json:"content"`
+	Citations      []services.Citation `json:"citations,omitempty"`
+	OutsideArticle bool                `json:"outside_article,omitempty"`
+	CreatedAt      string              `json:"created_at"`
+}
+
+type CreateChatThreadRequest struct {
+	Title *string `json:"title,omitempty"`
+}
+
+// maxThreadTitleLength bounds the title derived from a thread's first message
+const maxThreadTitleLength = 80
+
+// CreateThread starts a new chat thread for an article
+func (h *ChatHandler) CreateThread(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	articleID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional
+	var req CreateChatThreadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`, articleID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	var title *string
+	if req.Title != nil && strings.TrimSpace(*req.Title) != "" {
+		trimmed := strings.TrimSpace(*req.Title)
+		title = &trimmed
+	}
+
+	thread := ChatThread{ArticleID: articleID, Title: title}
+	query := `INSERT INTO chat_threads (article_id, user_id, title)
+	          VALUES ($1, $2, $3)
+	          RETURNING id, created_at, updated_at`
+	err = h.db.QueryRow(query, articleID, userID, title).Scan(&thread.ID, &thread.CreatedAt, &thread.UpdatedAt)
+	if err != nil {
+		http.Error(w, "Failed to create thread", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(thread)
+}
+
+// GetThreads lists the chat threads of an article, most recently active first
+func (h *ChatHandler) GetThreads(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	articleID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	query := `SELECT t.id, t.article_id, t.title, t.created_at, t.updated_at,
+	          (SELECT COUNT(*) FROM chat_messages m WHERE m.thread_id = t.id)
+	          FROM chat_threads t
+	          JOIN articles a ON a.id = t.article_id
+	          WHERE t.article_id = $1 AND t.user_id = $2 AND a.deleted_at IS NULL
+	          ORDER BY t.updated_at DESC`
+
+	rows, err := h.db.Query(query, articleID, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch threads", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	threads := []ChatThread{}
+	for rows.Next() {
+		var thread ChatThread
+		err := rows.Scan(&thread.ID, &thread.ArticleID, &thread.Title, &thread.CreatedAt, &thread.UpdatedAt, &thread.MessageCount)
+		if err != nil {
+			http.Error(w, "Failed to scan thread", http.StatusInternalServerError)
+			return
+		}
+		threads = append(threads, thread)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(threads)
+}
+
+// GetThread returns a chat thread with all of its messages
+func (h *ChatHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	articleID, threadID, ok := threadIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var thread ChatThread
+	query := `SELECT t.id, t.article_id, t.title, t.created_at, t.updated_at
+	          FROM chat_threads t
+	          JOIN articles a ON a.id = t.article_id
+	          WHERE t.id = $1 AND t.article_id = $2 AND t.user_id = $3 AND a.deleted_at IS NULL`
+	err := h.db.QueryRow(query, threadID, articleID, userID).Scan(
+		&thread.ID, &thread.ArticleID, &thread.Title, &thread.CreatedAt, &thread.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Thread not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch thread", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT id, role, content, citations, outside_article, created_at FROM chat_messages
+	                         WHERE thread_id = $1 ORDER BY id`, threadID)
+	if err != nil {
+		http.Error(w, "Failed to fetch thread messages", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	thread.Messages = []ChatThreadMessage{}
+	for rows.Next() {
+		var message ChatThreadMessage
+		var citations []byte
+		err := rows.Scan(&message.ID, &message.Role, &message.Content, &citations, &message.OutsideArticle, &message.CreatedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan thread message", http.StatusInternalServerError)
+			return
+		}
+		if citations != nil {
+			if err := json.Unmarshal(citations, &message.Citations); err != nil {
+				http.Error(w, "Failed to decode message citations", http.StatusInternalServerError)
+				return
+			}
+		}
+		thread.Messages = append(thread.Messages, message)
+	}
+	thread.MessageCount = len(thread.Messages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// DeleteThread deletes a chat thread and its messages
+func (h *ChatHandler) DeleteThread(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	articleID, threadID, ok := threadIDs(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM chat_threads WHERE id = $1 AND article_id = $2 AND user_id = $3`,
+		threadID, articleID, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete thread", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Thread not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// threadIDs parses the article and thread IDs from the URL, writing an error
+// response if either is invalid
+func threadIDs(w http.ResponseWriter, r *http.Request) (int64, int64, bool) {
+	vars := mux.Vars(r)
+	articleID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	threadID, err := strconv.ParseInt(vars["threadId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return articleID, threadID, true
+}
+
+// checkThread returns sql.ErrNoRows unless the thread belongs to the article and
+// user, and the article is not in the trash
+func (h *ChatHandler) checkThread(threadID, articleID int64, userID string) error {
+	var id int64
+	query := `SELECT t.id FROM chat_threads t
+	          JOIN articles a ON a.id = t.article_id
+	          WHERE t.id = $1 AND t.article_id = $2 AND t.user_id = $3 AND a.deleted_at IS NULL`
+	return h.db.QueryRow(query, threadID, articleID, userID).Scan(&id)
+}
+
+// loadHistory returns the messages of a thread in order
+func (h *ChatHandler) loadHistory(threadID int64) ([]services.ChatMessage, error) {
+	rows, err := h.db.Query(`SELECT role, content FROM chat_messages WHERE thread_id = $1 ORDER BY id`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []services.ChatMessage
+	for rows.Next() {
+		var message services.ChatMessage
+		if err := rows.Scan(&message.Role, &message.Content); err != nil {
+			return nil, err
+		}
+		history = append(history, message)
+	}
+	return history, rows.Err()
+}
+
+// saveExchange stores a user message and the assistant's reply in a thread,
+// titling the thread after its first message, and returns the reply's ID
+func (h *ChatHandler) saveExchange(threadID int64, userMessage string, reply *services.ChatAnswer) (int64, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	replyID, err := insertExchange(tx, threadID, userMessage, reply)
+	if err != nil {
+		return 0, err
+	}
+
+	return replyID, tx.Commit()
+}
+
+// saveChat saves an exchange to the request's thread, or to a new thread
+// when the request has none, and returns the thread and reply IDs
+func (h *ChatHandler) saveChat(articleID int64, userID string, req ChatRequest, history []services.ChatMessage, reply *services.ChatAnswer) (int64, int64, error) {
+	if req.ThreadID != nil {
+		replyID, err := h.saveExchange(*req.ThreadID, req.Message, reply)
+		return *req.ThreadID, replyID, err
+	}
+	return h.saveNewThread(articleID, userID, history, req.Message, reply)
+}
+
+// saveNewThread creates a thread holding the client-supplied history followed
+// by the new exchange, and returns the thread and reply IDs
+func (h *ChatHandler) saveNewThread(articleID int64, userID string, history []services.ChatMessage, userMessage string, reply *services.ChatAnswer) (int64, int64, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var threadID int64
+	if err := tx.QueryRow(`INSERT INTO chat_threads (article_id, user_id) VALUES ($1, $2) RETURNING id`,
+		articleID, userID).Scan(&threadID); err != nil {
+		return 0, 0, err
+	}
+
+	for _, message := range history {
+		if message.Role != "user" && message.Role != "assistant" {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT INTO chat_messages (thread_id, role, content) VALUES ($1, $2, $3)`,
+			threadID, message.Role, message.Content); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Name the thread after the conversation's first question
+	firstMessage := userMessage
+	for _, message := range history {
+		if message.Role == "user" {
+			firstMessage = message.Content
+			break
+		}
+	}
+	if _, err := tx.Exec(`UPDATE chat_threads SET title = $1 WHERE id = $2`, threadTitle(firstMessage), threadID); err != nil {
+		return 0, 0, err
+	}
+
+	replyID, err := insertExchange(tx, threadID, userMessage, reply)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return threadID, replyID, tx.Commit()
+}
+
+// insertExchange adds a user message and the assistant's reply, with its
+// citations, to a thread and returns the reply's ID
+func insertExchange(tx *sql.Tx, threadID int64, userMessage string, reply *services.ChatAnswer) (int64, error) {
+	citations, err := json.Marshal(reply.Citations)
+	if err != nil {
+		return 0, err
+	}
+
+	var userMessageID, replyID int64
+	err = tx.QueryRow(`INSERT INTO chat_messages (thread_id, role, content) VALUES ($1, 'user', $2) RETURNING id`,
+		threadID, userMessage).Scan(&userMessageID)
+	if err != nil {
+		return 0, err
+	}
+
+	insertQuery := `INSERT INTO chat_messages (thread_id, role, content, citations, outside_article)
+	                VALUES ($1, 'assistant', $2, $3, $4) RETURNING id`
+	err = tx.QueryRow(insertQuery, threadID, reply.Content, string(citations), reply.OutsideArticle).Scan(&replyID)
+	if err != nil {
+		return 0, err
+	}
+
+	updateQuery := `UPDATE chat_threads SET title = COALESCE(title, $1), updated_at = CURRENT_TIMESTAMP
+	                WHERE id = $2`
+	if _, err := tx.Exec(updateQuery, threadTitle(userMessage), threadID); err != nil {
+		return 0, err
+	}
+
+	return replyID, nil
+}
+
+// threadTitle derives a thread title from its first message
+func threadTitle(message string) string {
+	title := strings.Join(strings.Fields(message), " ")
+	if runes := []rune(title); len(runes) > maxThreadTitleLength {
+		title = strings.TrimSpace(string(runes[:maxThreadTitleLength-1])) + "…"
+	}
+	return title
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pocketscribe/internal/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Collection is a named, ordered list of articles, like a playlist
+type Collection struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Description  *string   `json:"description,omitempty"`
+	ArticleCount int       `json:"article_count"`
+	CreatedAt    string    `json:"created_at"`
+	UpdatedAt    string    `json:"updated_at"`
+	Articles     []Article `json:"articles,omitempty"`
+}
+
+type CollectionRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// AddToCollectionRequest adds an existing article by ID, or creates and
+// queues a new article from the remaining fields
+type AddToCollectionRequest struct {
+	ArticleID *int64 `json:"article_id,omitempty"`
+	CreateArticleRequest
+}
+
+type CollectionHandler struct {
+	db             *sql.DB
+	articleHandler *ArticleHandler
+}
+
+func NewCollectionHandler(db *sql.DB, articleHandler *ArticleHandler) *CollectionHandler {
+	return &CollectionHandler{
+		db:             db,
+		articleHandler: articleHandler,
+	}
+}
+
+// GetCollections lists the user's collections
+func (h *CollectionHandler) GetCollections(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `SELECT c.id, c.name, c.description, c.created_at, c.updated_at,
+	          (SELECT COUNT(*) FROM collection_articles ca JOIN articles a ON a.id = ca.article_id
+	           WHERE ca.collection_id = c.id AND a.deleted_at IS NULL)
+	          FROM collections c
+	          WHERE c.user_id = $1
+	          ORDER BY c.name`
+
+	rows, err := h.db.Query(query, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch collections", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(&collection.ID, &collection.Name, &collection.Description,
+			&collection.CreatedAt, &collection.UpdatedAt, &collection.ArticleCount)
+		if err != nil {
+			http.Error(w, "Failed to scan collection", http.StatusInternalServerError)
+			return
+		}
+		collections = append(collections, collection)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// CreateCollection creates an empty collection
+func (h *CollectionHandler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	collection := Collection{Name: strings.TrimSpace(*req.Name), Description: req.Description}
+	query := `INSERT INTO collections (user_id, name, description) VALUES ($1, $2, $3)
+	          RETURNING id, created_at, updated_at`
+	err := h.db.QueryRow(query, userID, collection.Name, collection.Description).Scan(
+		&collection.ID, &collection.CreatedAt, &collection.UpdatedAt,
+	)
+	if err != nil {
+		http.Error(w, "Failed to create collection", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(collection)
+}
+
+// GetCollection returns a collection with its articles in order
+func (h *CollectionHandler) GetCollection(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(r)["collectionId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	var collection Collection
+	query := `SELECT id, name, description, created_at, updated_at
+	          FROM collections WHERE id = $1 AND user_id = $2`
+	err = h.db.QueryRow(query, collectionID, userID).Scan(
+		&collection.ID, &collection.Name, &collection.Description, &collection.CreatedAt, &collection.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch collection", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT articles.id, articles.user_id, articles.url, articles.title, articles.format,
+	                         articles.length, articles.status, articles.thumbnail_path, articles.created_at,
+	                         articles.updated_at, articles.language, articles.style, articles.aspect_ratio,
+	                         articles.resolution, articles.audio_file_path, articles.video_file_path,
+	                         articles.duration_seconds, articles.error_message, articles.archived,
+	                         articles.favorited, `+articleTagsColumn+`
+	                         FROM collection_articles ca
+	                         JOIN articles ON articles.id = ca.article_id
+	                         WHERE ca.collection_id = $1 AND articles.deleted_at IS NULL
+	                         ORDER BY ca.position, ca.added_at`, collectionID)
+	if err != nil {
+		http.Error(w, "Failed to fetch collection articles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	collection.Articles = []Article{}
+	for rows.Next() {
+		var article Article
+		if err := rows.Scan(&article.ID, &article.UserID, &article.URL, &article.Title, &article.Format,
+			&article.Length, &article.Status, &article.ThumbnailPath, &article.CreatedAt,
+			&article.UpdatedAt, &article.Language, &article.Style, &article.AspectRatio,
+			&article.Resolution, &article.AudioFilePath, &article.VideoFilePath,
+			&article.DurationSeconds, &article.ErrorMessage, &article.Archived, &article.Favorited,
+			(*pq.StringArray)(&article.Tags)); err != nil {
+			http.Error(w, "Failed to scan article", http.StatusInternalServerError)
+			return
+		}
+		if err := h.articleHandler.media.signArticle(r.Context(), &article); err != nil {
+			http.Error(w, "Failed to sign media URLs", http.StatusInternalServerError)
+			return
+		}
+		collection.Articles = append(collection.Articles, article)
+	}
+	collection.ArticleCount = len(collection.Articles)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// UpdateCollection renames a collection or changes its description
+func (h *CollectionHandler) UpdateCollection(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(r)["collectionId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var name *string
+	if req.Name != nil {
+		trimmed := strings.TrimSpace(*req.Name)
+		if trimmed == "" {
+			http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		name = &trimmed
+	}
+
+	var collection Collection
+	query := `UPDATE collections
+	          SET name = COALESCE($1, name), description = COALESCE($2, description), updated_at = CURRENT_TIMESTAMP
+	          WHERE id = $3 AND user_id = $4
+	          RETURNING id, name, description, created_at, updated_at,
+	                    (SELECT COUNT(*) FROM collection_articles ca JOIN articles a ON a.id = ca.article_id
+	                     WHERE ca.collection_id = $3 AND a.deleted_at IS NULL)`
+	err = h.db.QueryRow(query, name, req.Description, collectionID, userID).Scan(
+		&collection.ID, &collection.Name, &collection.Description,
+		&collection.CreatedAt, &collection.UpdatedAt, &collection.ArticleCount,
+	)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update collection", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// DeleteCollection deletes a collection. Its articles are kept.
+func (h *CollectionHandler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(r)["collectionId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM collections WHERE id = $1 AND user_id = $2`, collectionID, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddArticle adds an existing article to the end of a collection, or creates
+// a new article from a URL and queues it straight into the collection
+func (h *CollectionHandler) AddArticle(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	collectionID, err := strconv.ParseInt(mux.Vars(r)["collectionId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+
+	var req AddToCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Queue a new article into the collection
+	if req.ArticleID == nil {
+		req.CollectionID = &collectionID
+		article, reqErr := h.articleHandler.createArticle(userID, req.CreateArticleRequest)
+		if reqErr != nil {
+			http.Error(w, reqErr.message, reqErr.status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(article)
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`, *req.ArticleID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to add article to collection", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	added, err := addToCollection(tx, collectionID, userID, *req.ArticleID)
+	if err != nil {
+		http.Error(w, "Failed to add article to collection", http.StatusInternalServerError)
+		return
+	}
+	if !added {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to add article to collection", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveArticle removes an article from a collection without deleting it
+func (h *CollectionHandler) RemoveArticle(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	collectionID, err := strconv.ParseInt(vars["collectionId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid collection ID", http.StatusBadRequest)
+		return
+	}
+	articleID, err := strconv.ParseInt(vars["articleId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM collection_articles
+	                          WHERE collection_id = $1 AND article_id = $2
+	                          AND collection_id IN (SELECT id FROM collections WHERE user_id = $3)`,
+		collectionID, articleID, userID)
+	if err != nil {
+		http.Error(w, "Failed to remove article from collection", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Article not found in collection", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addToCollection appends an article to the user's collection. It reports
+// false when the collection does not exist; adding an article twice is a no-op.
+func addToCollection(tx *sql.Tx, collectionID int64, userID string, articleID int64) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)`,
+		collectionID, userID).Scan(&exists)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO collection_articles (collection_id, article_id, position)
+	                  VALUES ($1, $2, (SELECT COALESCE(MAX(position), 0) + 1 FROM collection_articles WHERE collection_id = $1))
+	                  ON CONFLICT (collection_id, article_id) DO NOTHING`, collectionID, articleID)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`UPDATE collections SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, collectionID)
+	return err == nil, err
+}
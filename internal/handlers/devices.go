@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pocketscribe/internal/middleware"
+	"pocketscribe/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// Device is a device registered for push notifications
+type Device struct {
+	ID          int64   `json:"id"`
+	Token       string  `json:"token"`
+	Platform    string  `json:"platform"`
+	Channel     string  `json:"channel"`
+	Environment *string `json:"environment,omitempty"`
+	AppVersion  *string `json:"app_version,omitempty"`
+	CreatedAt   string  `json:"created_at"`
+	UpdatedAt   string  `json:"updated_at"`
+}
+
+// DeviceRequest registers a device. The token is the APNs or FCM device
+// token, or the endpoint of a browser push subscription, whose keys go in
+// Keys. Environment is the APNs environment that issued the token:
+// "sandbox" for development builds or "production"; devices that leave it
+// out are notified in the server's default environment.
+type DeviceRequest struct {
+	Token       string       `json:"token"`
+	Platform    string       `json:"platform"`
+	Environment string       `json:"environment"`
+	AppVersion  *string      `json:"app_version,omitempty"`
+	Keys        *WebPushKeys `json:"keys,omitempty"`
+}
+
+// WebPushKeys are the keys of a browser push subscription, as in
+// PushSubscription.toJSON()
+type WebPushKeys struct {
+	P256DH string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// devicePlatforms are the platforms devices can register from
+var devicePlatforms = []string{"ios", "ipados", "macos", "watchos", "visionos", "android", "web"}
+
+// maxDeviceTokenLength bounds device tokens; APNs tokens are 64 hex
+// characters and FCM tokens around 160 today, push service endpoints are longer
+const maxDeviceTokenLength = 1024
+
+type DeviceHandler struct {
+	db *sql.DB
+}
+
+func NewDeviceHandler(db *sql.DB) *DeviceHandler {
+	return &DeviceHandler{db: db}
+}
+
+// GetDevices lists the user's registered devices
+func (h *DeviceHandler) GetDevices(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `SELECT id, token, platform, channel, environment, app_version, created_at, updated_at
+	          FROM devices WHERE user_id = $1 ORDER BY updated_at DESC`
+
+	rows, err := h.db.Query(query, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch devices", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		var device Device
+		err := rows.Scan(&device.ID, &device.Token, &device.Platform, &device.Channel, &device.Environment, &device.AppVersion,
+			&device.CreatedAt, &device.UpdatedAt)
+		if err != nil {
+			http.Error(w, "Failed to scan device", http.StatusInternalServerError)
+			return
+		}
+		devices = append(devices, device)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(devices)
+}
+
+// RegisterDevice registers a device token for the user's notifications.
+// Apps call it on every launch; registering a known token updates it, and a
+// token registered by another user moves to this one.
+func (h *DeviceHandler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req DeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Platform == "" {
+		req.Platform = "ios"
+	}
+	if !containsString(devicePlatforms, req.Platform) {
+		http.Error(w, "Platform must be one of: "+strings.Join(devicePlatforms, ", "), http.StatusBadRequest)
+		return
+	}
+	channel := deviceChannel(req.Platform)
+
+	token := req.Token
+	var p256dh, auth *string
+	switch channel {
+	case services.ChannelAPNs:
+		token = normalizeDeviceToken(token)
+		if !validDeviceToken(token) {
+			http.Error(w, "Token must be a hex device token", http.StatusBadRequest)
+			return
+		}
+	case services.ChannelFCM:
+		token = strings.TrimSpace(token)
+		if token == "" || len(token) > maxDeviceTokenLength || strings.ContainsAny(token, " /") {
+			http.Error(w, "Token must be an FCM registration token", http.StatusBadRequest)
+			return
+		}
+	case services.ChannelWebPush:
+		endpoint, err := url.Parse(token)
+		if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" || len(token) > maxDeviceTokenLength {
+			http.Error(w, "Token must be the https endpoint of a push subscription", http.StatusBadRequest)
+			return
+		}
+		if req.Keys == nil || req.Keys.P256DH == "" || req.Keys.Auth == "" {
+			http.Error(w, "Keys p256dh and auth are required for web push subscriptions", http.StatusBadRequest)
+			return
+		}
+		p256dh, auth = &req.Keys.P256DH, &req.Keys.Auth
+	}
+
+	var environment *string
+	if req.Environment != "" {
+		if req.Environment != "sandbox" && req.Environment != "production" {
+			http.Error(w, "Environment must be 'sandbox' or 'production'", http.StatusBadRequest)
+			return
+		}
+		environment = &req.Environment
+	}
+
+	device := Device{
+		Token:       token,
+		Platform:    req.Platform,
+		Channel:     channel,
+		Environment: environment,
+		AppVersion:  req.AppVersion,
+	}
+	query := `INSERT INTO devices (user_id, token, platform, channel, environment, app_version, web_push_p256dh, web_push_auth)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	          ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform,
+	          channel = EXCLUDED.channel, environment = EXCLUDED.environment, app_version = EXCLUDED.app_version,
+	          web_push_p256dh = EXCLUDED.web_push_p256dh, web_push_auth = EXCLUDED.web_push_auth, updated_at = NOW()
+	          RETURNING id, created_at, updated_at`
+	err := h.db.QueryRow(query, userID, token, req.Platform, channel, environment, req.AppVersion, p256dh, auth).Scan(
+		&device.ID, &device.CreatedAt, &device.UpdatedAt)
+	if err != nil {
+		http.Error(w, "Failed to register device", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(device)
+}
+
+// UnregisterDevice stops notifications to a device, e.g. when the user signs
+// out. Web push endpoints, which don't fit in a path, go in the token query
+// parameter of DELETE /devices.
+func (h *DeviceHandler) UnregisterDevice(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, ok := mux.Vars(r)["token"]
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	// APNs tokens are stored normalized, other tokens as registered
+	result, err := h.db.Exec(`DELETE FROM devices WHERE token IN ($1, $2) AND user_id = $3`,
+		token, normalizeDeviceToken(token), userID)
+	if err != nil {
+		http.Error(w, "Failed to unregister device", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeDeviceToken lowercases a token and drops the spaces and angle
+// brackets of the NSData description format
+func normalizeDeviceToken(token string) string {
+	token = strings.NewReplacer(" ", "", "<", "", ">", "").Replace(token)
+	return strings.ToLower(strings.TrimSpace(token))
+}
+
+// deviceChannel returns the channel a platform receives notifications on
+func deviceChannel(platform string) string {
+	switch platform {
+	case "android":
+		return services.ChannelFCM
+	case "web":
+		return services.ChannelWebPush
+	default:
+		return services.ChannelAPNs
+	}
+}
+
+func validDeviceToken(token string) bool {
+	if token == "" || len(token) > maxDeviceTokenLength {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"pocketscribe/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+type FileHandler struct {
+	storage *services.LocalStorage
+}
+
+func NewFileHandler(storage *services.LocalStorage) *FileHandler {
+	return &FileHandler{
+		storage: storage,
+	}
+}
+
+// ServeFile serves a file from local storage to holders of a URL signed by
+// the storage. Range requests are supported, so audio and video can be seeked.
+func (h *FileHandler) ServeFile(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	query := r.URL.Query()
+	if !h.storage.VerifySignedURL(key, query.Get("expires"), query.Get("signature")) {
+		http.Error(w, "Invalid or expired URL", http.StatusForbidden)
+		return
+	}
+
+	file, info, err := h.storage.Open(key)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("ETag", info.ETag)
+	http.ServeContent(w, r, info.Key, info.LastModified, file)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pocketscribe/internal/middleware"
+	"pocketscribe/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// MediaHandler streams article media from storage for clients that can't
+// reach the storage host, with access checked by our own auth
+type MediaHandler struct {
+	db      *sql.DB
+	storage services.Storage
+	maxAge  time.Duration // how long clients may cache media without revalidating
+}
+
+func NewMediaHandler(db *sql.DB, storage services.Storage, maxAge time.Duration) *MediaHandler {
+	return &MediaHandler{
+		db:      db,
+		storage: storage,
+		maxAge:  maxAge,
+	}
+}
+
+// GetMedia streams an article's audio, video or thumbnail. Range requests are
+// passed through to storage, so players can seek without downloading the whole
+// file, and ETag and Last-Modified let clients revalidate their cached copy.
+func (h *MediaHandler) GetMedia(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	column, ok := services.ArtifactColumn(vars["kind"])
+	if !ok {
+		http.Error(w, "Media kind must be audio, video or thumbnail", http.StatusNotFound)
+		return
+	}
+
+	var key sql.NullString
+	query := fmt.Sprintf(`SELECT %s FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`, column)
+	err = h.db.QueryRowContext(r.Context(), query, id, userID).Scan(&key)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !key.Valid || key.String == "" {
+		http.Error(w, "Media not available", http.StatusNotFound)
+		return
+	}
+
+	info, err := h.storage.Stat(r.Context(), key.String)
+	if errors.Is(err, services.ErrFileNotFound) {
+		http.Error(w, "Media not available", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
+		return
+	}
+
+	reader := services.NewStorageReader(r.Context(), h.storage, info.Key, info.Size)
+	defer reader.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(h.maxAge.Seconds())))
+	http.ServeContent(w, r, info.Key, info.LastModified, reader)
+}
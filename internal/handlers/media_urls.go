@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"pocketscribe/internal/services"
+)
+
+// MediaURLs turns the storage keys saved on articles into signed URLs that
+// expire, so media is only reachable through a fresh article read
+type MediaURLs struct {
+	storage      services.Storage
+	mediaTTL     time.Duration // audio and video
+	thumbnailTTL time.Duration
+}
+
+func NewMediaURLs(storage services.Storage, mediaTTL, thumbnailTTL time.Duration) *MediaURLs {
+	return &MediaURLs{
+		storage:      storage,
+		mediaTTL:     mediaTTL,
+		thumbnailTTL: thumbnailTTL,
+	}
+}
+
+// signArticle replaces the thumbnail, audio and video keys of an article
+// with signed URLs
+func (m *MediaURLs) signArticle(ctx context.Context, article *Article) error {
+	for _, media := range []struct {
+		path *string
+		ttl  time.Duration
+	}{
+		{article.ThumbnailPath, m.thumbnailTTL},
+		{article.AudioFilePath, m.mediaTTL},
+		{article.VideoFilePath, m.mediaTTL},
+	} {
+		if err := m.sign(ctx, media.path, media.ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signThumbnail replaces a thumbnail key with a signed URL
+func (m *MediaURLs) signThumbnail(ctx context.Context, path *string) error {
+	return m.sign(ctx, path, m.thumbnailTTL)
+}
+
+// signKind replaces the key of an artifact of the given kind with a signed URL
+func (m *MediaURLs) signKind(ctx context.Context, kind string, path *string) error {
+	if kind == services.ArtifactThumbnail {
+		return m.sign(ctx, path, m.thumbnailTTL)
+	}
+	return m.sign(ctx, path, m.mediaTTL)
+}
+
+// sign replaces the key in path with a signed URL; nil and empty paths are left alone
+func (m *MediaURLs) sign(ctx context.Context, path *string, ttl time.Duration) error {
+	if path == nil || *path == "" {
+		return nil
+	}
+	url, err := m.storage.SignedURL(ctx, *path, ttl)
+	if err != nil {
+		return err
+	}
+	*path = url
+	return nil
+}
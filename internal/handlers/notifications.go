@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"pocketscribe/internal/middleware"
+	"pocketscribe/internal/services"
+)
+
+// NotificationPreferences says which channels each event is sent on, by
+// event and then channel. Channels lists the channels this server delivers
+// on; preferences for the others are kept but have no effect.
+type NotificationPreferences struct {
+	Preferences services.NotificationPreferences `json:"preferences"`
+	Channels    []string                         `json:"channels"`
+}
+
+type NotificationHandler struct {
+	db               *sql.DB
+	channels         []string
+	webPushPublicKey string
+}
+
+// NewNotificationHandler creates a handler for the channels the server is
+// configured to deliver on. webPushPublicKey is empty without Web Push.
+func NewNotificationHandler(db *sql.DB, channels []string, webPushPublicKey string) *NotificationHandler {
+	return &NotificationHandler{
+		db:               db,
+		channels:         channels,
+		webPushPublicKey: webPushPublicKey,
+	}
+}
+
+// GetPreferences returns the user's notification preferences, with the
+// defaults for anything they never changed
+func (h *NotificationHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	h.writePreferences(w, r, userID)
+}
+
+// UpdatePreferences turns channels on or off per event. Events and channels
+// left out of the request keep their current setting.
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req services.NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	for event, channels := range req {
+		if !containsString(services.NotificationEvents, event) {
+			http.Error(w, "Event must be one of: "+strings.Join(services.NotificationEvents, ", "), http.StatusBadRequest)
+			return
+		}
+		for channel := range channels {
+			if !containsString(services.NotificationChannels, channel) {
+				http.Error(w, "Channel must be one of: "+strings.Join(services.NotificationChannels, ", "), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to update preferences", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	for event, channels := range req {
+		for channel, enabled := range channels {
+			_, err := tx.Exec(`INSERT INTO notification_preferences (user_id, event, channel, enabled)
+			                   VALUES ($1, $2, $3, $4)
+			                   ON CONFLICT (user_id, event, channel) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = NOW()`,
+				userID, event, channel, enabled)
+			if err != nil {
+				http.Error(w, "Failed to update preferences", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to update preferences", http.StatusInternalServerError)
+		return
+	}
+
+	h.writePreferences(w, r, userID)
+}
+
+// GetWebPushKey returns the VAPID public key the web app subscribes with,
+// as the applicationServerKey of PushManager.subscribe()
+func (h *NotificationHandler) GetWebPushKey(w http.ResponseWriter, r *http.Request) {
+	if h.webPushPublicKey == "" {
+		http.Error(w, "Web push is not configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"public_key": h.webPushPublicKey})
+}
+
+func (h *NotificationHandler) writePreferences(w http.ResponseWriter, r *http.Request, userID string) {
+	prefs, err := services.LoadNotificationPreferences(r.Context(), h.db, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch preferences", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(NotificationPreferences{
+		Preferences: prefs,
+		Channels:    h.channels,
+	})
+}
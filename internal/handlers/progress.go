@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pocketscribe/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// Progress is how far a user got in one artifact of an article on one device.
+// Position is a scroll fraction from 0 to 1 for text, and a playback offset
+// in seconds for audio and video.
+type Progress struct {
+	DeviceID  string  `json:"device_id"`
+	Artifact  string  `json:"artifact"`
+	Position  float64 `json:"position"`
+	Completed bool    `json:"completed"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+// ProgressRequest reports progress from a device. UpdatedAt is the device's
+// clock when the progress was made and decides which write wins.
+type ProgressRequest struct {
+	DeviceID  string     `json:"device_id"`
+	Artifact  string     `json:"artifact"`
+	Position  float64    `json:"position"`
+	Completed bool       `json:"completed"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// ArticleProgress is the progress of an article on every device, with the
+// latest progress per artifact across devices
+type ArticleProgress struct {
+	Latest  map[string]Progress `json:"latest"`
+	Devices []Progress          `json:"devices"`
+}
+
+// progressArtifacts are the parts of an article progress can be tracked in
+var progressArtifacts = []string{"text", "audio", "video"}
+
+// maxProgressClockSkew bounds how far in the future a device clock may be
+// before its timestamp is replaced with the server's
+const maxProgressClockSkew = 5 * time.Minute
+
+// latestProgressQuery selects the most recent progress per artifact of the
+// article in the enclosing query
+const latestProgressQuery = `SELECT DISTINCT ON (ap.artifact) ap.artifact, ap.position, ap.completed,
+	ap.device_id, ap.client_updated_at
+	FROM article_progress ap
+	WHERE ap.article_id = articles.id AND ap.user_id = articles.user_id
+	ORDER BY ap.artifact, ap.client_updated_at DESC`
+
+// articleProgressColumn selects the latest progress per artifact as a JSON object
+const articleProgressColumn = `(SELECT json_object_agg(p.artifact, json_build_object(
+	'device_id', p.device_id, 'artifact', p.artifact, 'position', p.position,
+	'completed', p.completed, 'updated_at', p.client_updated_at))
+	FROM (` + latestProgressQuery + `) p) AS progress`
+
+// articleCompletedCondition matches articles whose latest progress in any
+// artifact is completed
+const articleCompletedCondition = `EXISTS (SELECT 1 FROM (` + latestProgressQuery + `) p WHERE p.completed)`
+
+type ProgressHandler struct {
+	db *sql.DB
+}
+
+func NewProgressHandler(db *sql.DB) *ProgressHandler {
+	return &ProgressHandler{db: db}
+}
+
+// UpdateProgress stores progress from a device. Writes older than what is
+// already stored for the device and artifact are ignored (last writer wins).
+// The response is the article's progress after the write.
+func (h *ProgressHandler) UpdateProgress(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	articleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.DeviceID == "" {
+		http.Error(w, "Device ID is required", http.StatusBadRequest)
+		return
+	}
+	if !containsString(progressArtifacts, req.Artifact) {
+		http.Error(w, "Artifact must be 'text', 'audio', or 'video'", http.StatusBadRequest)
+		return
+	}
+	if req.Position < 0 || (req.Artifact == "text" && req.Position > 1) {
+		http.Error(w, "Position must be a fraction from 0 to 1 for text, or seconds for audio and video", http.StatusBadRequest)
+		return
+	}
+
+	// Don't let a device with a fast clock win every future write
+	now := time.Now()
+	updatedAt := now
+	if req.UpdatedAt != nil && req.UpdatedAt.Before(now.Add(maxProgressClockSkew)) {
+		updatedAt = *req.UpdatedAt
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`, articleID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	query := `INSERT INTO article_progress (user_id, article_id, device_id, artifact, position, completed, client_updated_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+	          ON CONFLICT (user_id, article_id, device_id, artifact) DO UPDATE
+	          SET position = EXCLUDED.position, completed = EXCLUDED.completed,
+	              client_updated_at = EXCLUDED.client_updated_at, updated_at = CURRENT_TIMESTAMP
+	          WHERE article_progress.client_updated_at < EXCLUDED.client_updated_at`
+	if _, err := h.db.Exec(query, userID, articleID, req.DeviceID, req.Artifact, req.Position, req.Completed, updatedAt); err != nil {
+		http.Error(w, "Failed to save progress", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeProgress(w, articleID, userID)
+}
+
+// GetProgress returns the article's progress on every device
+func (h *ProgressHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	articleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = h.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`, articleID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	h.writeProgress(w, articleID, userID)
+}
+
+// writeProgress responds with the progress of an article on every device
+func (h *ProgressHandler) writeProgress(w http.ResponseWriter, articleID int64, userID string) {
+	rows, err := h.db.Query(`SELECT device_id, artifact, position, completed, client_updated_at
+	                         FROM article_progress
+	                         WHERE article_id = $1 AND user_id = $2
+	                         ORDER BY client_updated_at DESC`, articleID, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch progress", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	progress := ArticleProgress{
+		Latest:  make(map[string]Progress),
+		Devices: []Progress{},
+	}
+	for rows.Next() {
+		var p Progress
+		if err := rows.Scan(&p.DeviceID, &p.Artifact, &p.Position, &p.Completed, &p.UpdatedAt); err != nil {
+			http.Error(w, "Failed to scan progress", http.StatusInternalServerError)
+			return
+		}
+		progress.Devices = append(progress.Devices, p)
+
+		// Rows are newest first, so the first row per artifact is the latest
+		if _, seen := progress.Latest[p.Artifact]; !seen {
+			progress.Latest[p.Artifact] = p
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
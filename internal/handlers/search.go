@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pocketscribe/internal/middleware"
+	"pocketscribe/internal/services"
+)
+
+// Retrieval limits for library search and chat
+const (
+	defaultSearchLimit    = 10
+	maxSearchLimit        = 50
+	passagesPerArticle    = 3
+	libraryChatSources    = 8
+	searchCandidateFactor = 4
+)
+
+type SearchHandler struct {
+	vectorIndex   services.VectorIndex
+	geminiService *services.GeminiService
+}
+
+func NewSearchHandler(vectorIndex services.VectorIndex, geminiService *services.GeminiService) *SearchHandler {
+	return &SearchHandler{
+		vectorIndex:   vectorIndex,
+		geminiService: geminiService,
+	}
+}
+
+// SearchResult is an article matching a semantic search, with its best passages
+type SearchResult struct {
+	ArticleID int64           `json:"article_id"`
+	Title     *string         `json:"title,omitempty"`
+	URL       string          `json:"url"`
+	Score     float64         `json:"score"`
+	Passages  []SearchPassage `json:"passages"`
+}
+
+// SearchPassage is a passage of an article that matched a search. Start and
+// End are character offsets into the article's original content.
+type SearchPassage struct {
+	ChunkIndex int     `json:"chunk_index"`
+	Text       string  `json:"text"`
+	Start      int     `json:"start"`
+	End        int     `json:"end"`
+	Score      float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+}
+
+type LibraryChatRequest struct {
+	Message     string                 `json:"message"`
+	ChatHistory []services.ChatMessage `json:"chat_history"`
+}
+
+type LibraryChatResponse struct {
+	Role           string                     `json:"role"`
+	Content        string                     `json:"content"`
+	Citations      []services.LibraryCitation `json:"citations"`
+	OutsideLibrary bool                       `json:"outside_library"`
+}
+
+// Search finds the user's articles whose content is semantically closest to
+// the query, best match first
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxSearchLimit {
+			http.Error(w, "Limit must be between 1 and 50", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	vector, err := h.geminiService.EmbedQuery(r.Context(), query)
+	if err != nil {
+		http.Error(w, "Failed to embed query: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch extra passages so articles with several strong passages still
+	// leave room for other articles
+	matches, err := h.vectorIndex.Search(r.Context(), userID, vector, limit*searchCandidateFactor)
+	if err != nil {
+		http.Error(w, "Failed to search articles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SearchResponse{
+		Query:   query,
+		Results: groupMatches(matches, limit),
+	})
+}
+
+// ChatWithLibrary answers a question over the user's whole library, citing
+// the articles the answer draws on
+func (h *SearchHandler) ChatWithLibrary(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req LibraryChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Message == "" {
+		http.Error(w, "Message is required", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve with the latest question; the history gives the model context
+	vector, err := h.geminiService.EmbedQuery(r.Context(), req.Message)
+	if err != nil {
+		http.Error(w, "Failed to embed message: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sources, err := h.vectorIndex.Search(r.Context(), userID, vector, libraryChatSources)
+	if err != nil {
+		http.Error(w, "Failed to search articles", http.StatusInternalServerError)
+		return
+	}
+
+	answer, err := h.geminiService.ChatWithLibrary(r.Context(), sources, req.ChatHistory, req.Message)
+	if err != nil {
+		http.Error(w, "Failed to generate response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LibraryChatResponse{
+		Role:           "assistant",
+		Content:        answer.Content,
+		Citations:      answer.Citations,
+		OutsideLibrary: answer.OutsideLibrary,
+	})
+}
+
+// groupMatches groups passages by article, keeping the order of each
+// article's best passage, and returns at most limit articles
+func groupMatches(matches []services.ChunkMatch, limit int) []SearchResult {
+	results := []SearchResult{}
+	byArticle := make(map[int64]int)
+
+	for _, match := range matches {
+		i, seen := byArticle[match.ArticleID]
+		if !seen {
+			if len(results) == limit {
+				continue
+			}
+			i = len(results)
+			byArticle[match.ArticleID] = i
+			results = append(results, SearchResult{
+				ArticleID: match.ArticleID,
+				Title:     match.Title,
+				URL:       match.URL,
+				Score:     match.Score,
+				Passages:  []SearchPassage{},
+			})
+		}
+
+		if len(results[i].Passages) < passagesPerArticle {
+			results[i].Passages = append(results[i].Passages, SearchPassage{
+				ChunkIndex: match.ChunkIndex,
+				Text:       match.Text,
+				Start:      match.Start,
+				End:        match.End,
+				Score:      match.Score,
+			})
+		}
+	}
+
+	return results
+}
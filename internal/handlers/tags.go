@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"pocketscribe/internal/middleware"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Tag is a user-defined label for articles
+type Tag struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	ArticleCount int    `json:"article_count"`
+	CreatedAt    string `json:"created_at"`
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type ArticleTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// maxTagLength bounds tag names
+const maxTagLength = 50
+
+// articleTagsColumn selects an article's tag names, sorted, as a text array
+const articleTagsColumn = `ARRAY(SELECT t.name FROM article_tags at JOIN tags t ON t.id = at.tag_id
+	WHERE at.article_id = articles.id ORDER BY t.name) AS tags`
+
+type TagHandler struct {
+	db *sql.DB
+}
+
+func NewTagHandler(db *sql.DB) *TagHandler {
+	return &TagHandler{db: db}
+}
+
+// GetTags lists the user's tags with how many articles use each
+func (h *TagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `SELECT t.id, t.name, t.created_at, COUNT(a.id)
+	          FROM tags t
+	          LEFT JOIN article_tags at ON at.tag_id = t.id
+	          LEFT JOIN articles a ON a.id = at.article_id AND a.deleted_at IS NULL
+	          WHERE t.user_id = $1
+	          GROUP BY t.id
+	          ORDER BY t.name`
+
+	rows, err := h.db.Query(query, userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.CreatedAt, &tag.ArticleCount); err != nil {
+			http.Error(w, "Failed to scan tag", http.StatusInternalServerError)
+			return
+		}
+		tags = append(tags, tag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// CreateTag adds a tag to the user's vocabulary
+func (h *TagHandler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := normalizeTagName(req.Name)
+	if err := validateTagName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tag := Tag{Name: name}
+	query := `INSERT INTO tags (user_id, name) VALUES ($1, $2)
+	          ON CONFLICT (user_id, name) DO NOTHING
+	          RETURNING id, created_at`
+	err := h.db.QueryRow(query, userID, name).Scan(&tag.ID, &tag.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// UpdateTag renames a tag
+func (h *TagHandler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(mux.Vars(r)["tagId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	var req TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := normalizeTagName(req.Name)
+	if err := validateTagName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tag := Tag{ID: tagID, Name: name}
+	query := `UPDATE tags SET name = $1 WHERE id = $2 AND user_id = $3
+	          RETURNING created_at, (SELECT COUNT(*) FROM article_tags at JOIN articles a ON a.id = at.article_id
+	                               WHERE at.tag_id = $2 AND a.deleted_at IS NULL)`
+	err = h.db.QueryRow(query, name, tagID, userID).Scan(&tag.CreatedAt, &tag.ArticleCount)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		http.Error(w, "Tag already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// DeleteTag deletes a tag and removes it from all articles
+func (h *TagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	tagID, err := strconv.ParseInt(mux.Vars(r)["tagId"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid tag ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.Exec(`DELETE FROM tags WHERE id = $1 AND user_id = $2`, tagID, userID)
+	if err != nil {
+		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetArticleTags replaces the tags of an article. Tags that do not exist yet
+// are created.
+func (h *TagHandler) SetArticleTags(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	articleID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ArticleTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := normalizeTagNames(req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to tag article", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM articles WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)`, articleID, userID).Scan(&exists)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Article not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := tx.Exec(`DELETE FROM article_tags WHERE article_id = $1`, articleID); err != nil {
+		http.Error(w, "Failed to tag article", http.StatusInternalServerError)
+		return
+	}
+	if err := setArticleTags(tx, userID, articleID, tags); err != nil {
+		http.Error(w, "Failed to tag article", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to tag article", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ArticleTagsRequest{Tags: tags})
+}
+
+// setArticleTags adds user tags to an article, creating missing tags
+func setArticleTags(tx *sql.Tx, userID string, articleID int64, names []string) error {
+	for _, name := range names {
+		var tagID int64
+		err := tx.QueryRow(`INSERT INTO tags (user_id, name) VALUES ($1, $2)
+		                    ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+		                    RETURNING id`, userID, name).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO article_tags (article_id, tag_id, source) VALUES ($1, $2, 'user')
+		                  ON CONFLICT (article_id, tag_id) DO UPDATE SET source = 'user'`, articleID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeTagName lowercases a tag and collapses its whitespace, so "Machine
+// Learning" and "machine  learning" are the same tag
+func normalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func validateTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("Tag name is required")
+	}
+	if utf8.RuneCountInString(name) > maxTagLength {
+		return fmt.Errorf("Tag names must be at most %d characters", maxTagLength)
+	}
+	return nil
+}
+
+// normalizeTagNames normalizes, validates and de-duplicates tag names
+func normalizeTagNames(names []string) ([]string, error) {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = normalizeTagName(name)
+		if err := validateTagName(name); err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			tags = append(tags, name)
+		}
+	}
+	return tags, nil
+}
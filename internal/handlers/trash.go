@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pocketscribe/internal/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// TrashedArticle is a deleted article that can still be restored
+type TrashedArticle struct {
+	ID            int64   `json:"id"`
+	URL           string  `json:"url"`
+	Title         *string `json:"title,omitempty"`
+	Format        string  `json:"format"`
+	ThumbnailPath *string `json:"thumbnail_path,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+	DeletedAt     string  `json:"deleted_at"`
+	PurgeAt       string  `json:"purge_at"` // when the article and its files are deleted for good
+}
+
+type TrashHandler struct {
+	db             *sql.DB
+	articleHandler *ArticleHandler
+	retention      time.Duration
+}
+
+func NewTrashHandler(db *sql.DB, articleHandler *ArticleHandler, retention time.Duration) *TrashHandler {
+	return &TrashHandler{
+		db:             db,
+		articleHandler: articleHandler,
+		retention:      retention,
+	}
+}
+
+// GetTrash lists the user's deleted articles that are still within the
+// retention window, most recently deleted first
+func (h *TrashHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `SELECT id, url, title, format, thumbnail_path, created_at, deleted_at,
+	          deleted_at + make_interval(secs => $2)
+	          FROM articles
+	          WHERE user_id = $1 AND deleted_at >= NOW() - make_interval(secs => $2)
+	          ORDER BY deleted_at DESC`
+
+	rows, err := h.db.Query(query, userID, h.retention.Seconds())
+	if err != nil {
+		http.Error(w, "Failed to fetch trash", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	articles := []TrashedArticle{}
+	for rows.Next() {
+		var article TrashedArticle
+		err := rows.Scan(&article.ID, &article.URL, &article.Title, &article.Format, &article.ThumbnailPath,
+			&article.CreatedAt, &article.DeletedAt, &article.PurgeAt)
+		if err != nil {
+			http.Error(w, "Failed to scan article", http.StatusInternalServerError)
+			return
+		}
+		if err := h.articleHandler.media.signThumbnail(r.Context(), article.ThumbnailPath); err != nil {
+			http.Error(w, "Failed to sign media URLs", http.StatusInternalServerError)
+			return
+		}
+		articles = append(articles, article)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(articles)
+}
+
+// RestoreArticle moves an article out of the trash, as long as it is still
+// within the retention window
+func (h *TrashHandler) RestoreArticle(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context (set by auth middleware)
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	query := `UPDATE articles SET deleted_at = NULL
+	          WHERE id = $1 AND user_id = $2 AND deleted_at >= NOW() - make_interval(secs => $3)`
+	result, err := h.db.Exec(query, id, userID, h.retention.Seconds())
+	if err != nil {
+		http.Error(w, "Failed to restore article", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		http.Error(w, "Article not found in trash", http.StatusNotFound)
+		return
+	}
+
+	article, err := h.articleHandler.getArticle(r.Context(), int64(id), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch article", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(article)
+}
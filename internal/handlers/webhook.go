@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"pocketscribe/internal/services"
+)
+
+type FalWebhookHandler struct {
+	secret    string
+	processor SceneResultProcessor
+}
+
+type SceneResultProcessor interface {
+	HandleSceneResult(articleID int64, sceneIndex int, requestID, videoURL, errorMessage string) error
+}
+
+func NewFalWebhookHandler(secret string, processor SceneResultProcessor) *FalWebhookHandler {
+	return &FalWebhookHandler{
+		secret:    secret,
+		processor: processor,
+	}
+}
+
+// HandleFalWebhook receives Fal's completion callback for a video scene and
+// resumes the article's pipeline. The callback URL is signed when the scene is
+// submitted, so only URLs we handed to Fal are accepted, and the result must
+// name the Fal request stored for the scene.
+func (h *FalWebhookHandler) HandleFalWebhook(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	articleID, err := strconv.ParseInt(query.Get("article_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid article ID", http.StatusBadRequest)
+		return
+	}
+
+	sceneIndex, err := strconv.Atoi(query.Get("scene"))
+	if err != nil {
+		http.Error(w, "Invalid scene", http.StatusBadRequest)
+		return
+	}
+
+	if !services.VerifyFalWebhook(h.secret, articleID, sceneIndex, query.Get("sig")) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload services.FalWebhookPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if payload.RequestID == "" {
+		http.Error(w, "request_id is required", http.StatusBadRequest)
+		return
+	}
+
+	var videoURL, errorMessage string
+	if payload.Status == "OK" {
+		videoURL, err = payload.VideoURL()
+		if err != nil {
+			errorMessage = err.Error()
+		}
+	} else {
+		errorMessage = payload.Error
+		if errorMessage == "" {
+			errorMessage = "video generation failed"
+		}
+	}
+
+	err = h.processor.HandleSceneResult(articleID, sceneIndex, payload.RequestID, videoURL, errorMessage)
+	if errors.Is(err, services.ErrUnknownFalRequest) {
+		log.Printf("Rejected Fal webhook for article %d scene %d: %v", articleID, sceneIndex, err)
+		http.Error(w, "Unknown request", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to handle Fal webhook for article %d scene %d: %v", articleID, sceneIndex, err)
+		http.Error(w, "Failed to handle webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
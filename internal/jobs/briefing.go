@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"pocketscribe/internal/services"
+)
+
+// BriefingOptions configures the daily briefing notification
+type BriefingOptions struct {
+	Hour          int           // hour of the day, in UTC, briefings are sent from
+	CheckInterval time.Duration // how often the job looks for users due a briefing
+}
+
+// briefingWindow is how far back a briefing looks for new articles
+const briefingWindow = 24 * time.Hour
+
+// RunDailyBriefings sends each user who enabled the daily briefing a summary
+// of the articles that became ready in the last day, once a day from the
+// configured hour. It blocks until ctx is cancelled.
+func (p *Processor) RunDailyBriefings(ctx context.Context) {
+	if p.notifications == nil {
+		return
+	}
+
+	interval := p.briefing.CheckInterval
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+
+	p.sendDailyBriefings(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.sendDailyBriefings(ctx)
+		}
+	}
+}
+
+func (p *Processor) sendDailyBriefings(ctx context.Context) {
+	now := time.Now().UTC()
+	if now.Hour() < p.briefing.Hour {
+		return
+	}
+	today := now.Format("2006-01-02")
+
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT np.user_id FROM notification_preferences np
+	                                     WHERE np.event = $1 AND np.enabled
+	                                     AND NOT EXISTS (SELECT 1 FROM daily_briefings sent
+	                                                     WHERE sent.user_id = np.user_id AND sent.sent_on = $2)`,
+		services.EventDailyBriefing, today)
+	if err != nil {
+		log.Printf("Failed to find users due a daily briefing: %v", err)
+		return
+	}
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("Failed to scan user due a daily briefing: %v", err)
+			rows.Close()
+			return
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := p.sendDailyBriefing(ctx, userID, today); err != nil {
+			log.Printf("Failed to send daily briefing to user %s: %v", userID, err)
+		}
+	}
+}
+
+// sendDailyBriefing claims the user's briefing for the day, so only one
+// server sends it, then sends it unless there is nothing new
+func (p *Processor) sendDailyBriefing(ctx context.Context, userID, today string) error {
+	result, err := p.db.ExecContext(ctx, `INSERT INTO daily_briefings (user_id, sent_on) VALUES ($1, $2)
+	                                      ON CONFLICT DO NOTHING`, userID, today)
+	if err != nil {
+		return err
+	}
+	if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	rows, err := p.db.QueryContext(ctx, `SELECT a.id, COALESCE(a.title, ''), a.url, a.format FROM articles a
+	                                     WHERE a.user_id = $1 AND a.status = 'ready' AND NOT a.archived AND a.deleted_at IS NULL
+	                                     AND a.created_at > NOW() - make_interval(secs => $2)
+	                                     AND NOT EXISTS (SELECT 1 FROM article_progress ap
+	                                                     WHERE ap.article_id = a.id AND ap.user_id = a.user_id)
+	                                     ORDER BY a.created_at DESC`, userID, briefingWindow.Seconds())
+	if err != nil {
+		return err
+	}
+
+	var articles []services.ArticleNotification
+	for rows.Next() {
+		var article services.ArticleNotification
+		if err := rows.Scan(&article.ArticleID, &article.Title, &article.URL, &article.Format); err != nil {
+			rows.Close()
+			return err
+		}
+		articles = append(articles, article)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(articles) == 0 {
+		log.Printf("No new articles for user %s, skipping daily briefing", userID)
+		return nil
+	}
+
+	badge, err := p.unreadCount(userID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Sending daily briefing with %d articles to user %s", len(articles), userID)
+	return p.notifications.Notify(ctx, userID, services.NewDailyBriefingNotification(articles, badge))
+}
@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"unicode/utf8"
+
+	"pocketscribe/internal/services"
+)
+
+// SearchOptions configures how articles are indexed for semantic search
+type SearchOptions struct {
+	ChunkTokens int // target size of each embedded passage
+}
+
+// indexArticle splits an article's content into passages, embeds them and
+// stores them in the vector index, replacing any earlier passages
+func (p *Processor) indexArticle(ctx context.Context, articleID int64, content string) error {
+	chunkTokens := p.search.ChunkTokens
+	if chunkTokens <= 0 {
+		chunkTokens = 400
+	}
+
+	sections := services.ChunkContent(content, chunkTokens)
+	if len(sections) == 0 {
+		return nil
+	}
+
+	texts := make([]string, len(sections))
+	for i, section := range sections {
+		texts[i] = section.Text
+	}
+
+	embeddings, err := p.geminiService.EmbedDocuments(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed passages: %w", err)
+	}
+
+	// Citations use character offsets, sections come with byte offsets
+	chunks := make([]services.EmbeddedChunk, len(sections))
+	for i, section := range sections {
+		start := utf8.RuneCountInString(content[:section.Start])
+		chunks[i] = services.EmbeddedChunk{
+			Index:     i,
+			Text:      section.Text,
+			Start:     start,
+			End:       start + utf8.RuneCountInString(content[section.Start:section.End]),
+			Embedding: embeddings[i],
+		}
+	}
+
+	return p.vectorIndex.Replace(ctx, articleID, chunks)
+}
+
+// BackfillEmbeddings indexes ready articles that have no passages yet, such
+// as articles processed before semantic search existed
+func (p *Processor) BackfillEmbeddings(ctx context.Context) {
+	query := `SELECT a.id FROM articles a
+	          WHERE a.status = 'ready' AND a.original_content IS NOT NULL AND a.deleted_at IS NULL
+	          AND NOT EXISTS (SELECT 1 FROM article_chunks c WHERE c.article_id = a.id)
+	          ORDER BY a.id`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		log.Printf("Failed to find articles to index: %v", err)
+		return
+	}
+
+	var articleIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			log.Printf("Failed to scan article to index: %v", err)
+			rows.Close()
+			return
+		}
+		articleIDs = append(articleIDs, id)
+	}
+	rows.Close()
+
+	if len(articleIDs) == 0 {
+		return
+	}
+	log.Printf("Indexing %d articles for semantic search", len(articleIDs))
+
+	for _, articleID := range articleIDs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		var content string
+		if err := p.db.QueryRowContext(ctx, `SELECT original_content FROM articles WHERE id = $1`, articleID).Scan(&content); err != nil {
+			log.Printf("Failed to load article %d for indexing: %v", articleID, err)
+			continue
+		}
+		if err := p.indexArticle(ctx, articleID, content); err != nil {
+			log.Printf("Failed to index article %d: %v", articleID, err)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package jobs
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"pocketscribe/internal/services"
 )
@@ -13,19 +16,33 @@ type Processor struct {
 	db                *sql.DB
 	geminiService     *services.GeminiService
 	elevenLabsService *services.ElevenLabsService
-	storageService    *services.StorageService
-	apnsService       *services.APNSService
+	storageService    services.Storage
+	artifacts         *services.ArtifactStore
+	notifications     *services.NotificationDispatcher
 	falService        *services.FalService
+	videoComposer     *services.VideoComposer
+	vectorIndex       services.VectorIndex
+	video             VideoOptions
+	search            SearchOptions
+	trash             TrashOptions
+	briefing          BriefingOptions
 }
 
-func NewProcessor(db *sql.DB, geminiService *services.GeminiService, elevenLabsService *services.ElevenLabsService, storageService *services.StorageService, apnsService *services.APNSService, falService *services.FalService) *Processor {
+func NewProcessor(db *sql.DB, geminiService *services.GeminiService, elevenLabsService *services.ElevenLabsService, storageService services.Storage, artifacts *services.ArtifactStore, notifications *services.NotificationDispatcher, falService *services.FalService, videoComposer *services.VideoComposer, vectorIndex services.VectorIndex, video VideoOptions, search SearchOptions, trash TrashOptions, briefing BriefingOptions) *Processor {
 	return &Processor{
 		db:                db,
 		geminiService:     geminiService,
 		elevenLabsService: elevenLabsService,
 		storageService:    storageService,
-		apnsService:       apnsService,
+		artifacts:         artifacts,
+		notifications:     notifications,
 		falService:        falService,
+		videoComposer:     videoComposer,
+		vectorIndex:       vectorIndex,
+		video:             video,
+		search:            search,
+		trash:             trash,
+		briefing:          briefing,
 	}
 }
 
@@ -40,10 +57,16 @@ func (p *Processor) ProcessArticle(articleID int64) {
 	}
 
 	// Get article details
-	var url, format, length string
+	var userID, url, format, length, aspectRatio string
 	var language, style sql.NullString
-	query := `SELECT url, format, length, language, style FROM articles WHERE id = $1`
-	err := p.db.QueryRow(query, articleID).Scan(&url, &format, &length, &language, &style)
+	var autoTag bool
+	query := `SELECT user_id, url, format, length, language, style, aspect_ratio, auto_tag FROM articles WHERE id = $1 AND deleted_at IS NULL`
+	err := p.db.QueryRow(query, articleID).Scan(&userID, &url, &format, &length, &language, &style, &aspectRatio, &autoTag)
+	if err == sql.ErrNoRows {
+		// Moved to the trash before processing started
+		log.Printf("Article %d was deleted, skipping processing", articleID)
+		return
+	}
 	if err != nil {
 		log.Printf("Failed to get article %d details: %v", articleID, err)
 		p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to get article details: %v", err))
@@ -62,7 +85,7 @@ func (p *Processor) ProcessArticle(articleID int64) {
 	}
 
 	log.Printf("Summarizing article %d with length %s and style %s", articleID, length, styleStr)
-	originalContent, summary, err := p.geminiService.SummarizeArticle(url, length, languageStr, styleStr)
+	articleSummary, err := p.geminiService.SummarizeArticle(url, length, languageStr, styleStr)
 	if err != nil {
 		log.Printf("Failed to summarize article %d: %v", articleID, err)
 		p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to summarize: %v", err))
@@ -70,6 +93,11 @@ func (p *Processor) ProcessArticle(articleID int64) {
 		return
 	}
 
+	// The speech script drives TTS and video narration, the Markdown
+	// rendition is the reading copy
+	originalContent := articleSummary.Content
+	summary := articleSummary.Speech
+
 	// Generate title from the original content
 	log.Printf("Generating title for article %d", articleID)
 	title, err := p.geminiService.GenerateTitle(originalContent)
@@ -80,10 +108,24 @@ func (p *Processor) ProcessArticle(articleID int64) {
 		title = "Untitled Article"
 	}
 
-	// Save the original content, title, and summary
-	updateQuery := `UPDATE articles SET original_content = $1, title = $2, summary = $3, updated_at = CURRENT_TIMESTAMP
-	                WHERE id = $4`
-	if _, err := p.db.Exec(updateQuery, originalContent, title, summary, articleID); err != nil {
+	// Extract key points, quotes and entities alongside the spoken summary
+	log.Printf("Generating structured summary for article %d", articleID)
+	var structuredSummary sql.NullString
+	structured, err := p.geminiService.GenerateStructuredSummary(originalContent, summary, languageStr)
+	if err != nil {
+		log.Printf("Failed to generate structured summary for article %d: %v", articleID, err)
+		// Don't fail the entire process, the spoken summary is still usable
+	} else if data, err := json.Marshal(structured); err != nil {
+		log.Printf("Failed to encode structured summary for article %d: %v", articleID, err)
+	} else {
+		structuredSummary = sql.NullString{String: string(data), Valid: true}
+	}
+
+	// Save the original content, title, and both summary renditions
+	updateQuery := `UPDATE articles SET original_content = $1, title = $2, summary = $3, text_body = $4,
+	                structured_summary = $5, updated_at = CURRENT_TIMESTAMP
+	                WHERE id = $6`
+	if _, err := p.db.Exec(updateQuery, originalContent, title, summary, articleSummary.Display, structuredSummary, articleID); err != nil {
 		log.Printf("Failed to save summary for article %d: %v", articleID, err)
 		p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to save summary: %v", err))
 		return
@@ -91,25 +133,37 @@ func (p *Processor) ProcessArticle(articleID int64) {
 
 	log.Printf("Successfully summarized article %d with title: %s", articleID, title)
 
+	// Tag the article from the user's existing tags
+	if autoTag {
+		if err := p.autoTagArticle(articleID, userID, title, summary); err != nil {
+			log.Printf("Failed to auto-tag article %d: %v", articleID, err)
+			// Don't fail the entire process, tags can be added by hand
+		}
+	}
+
+	// Index the content for semantic search across the library
+	if err := p.indexArticle(context.Background(), articleID, originalContent); err != nil {
+		log.Printf("Failed to index article %d for search: %v", articleID, err)
+		// Don't fail the entire process, the article is still usable without search
+	}
+
 	// Step 2: Generate thumbnail from summary
 	log.Printf("Generating thumbnail for article %d", articleID)
-	thumbnailData, err := p.geminiService.GenerateThumbnail(summary)
+	thumbnailData, err := p.geminiService.GenerateThumbnail(summary, aspectRatio)
 	if err != nil {
 		log.Printf("Failed to generate thumbnail for article %d: %v", articleID, err)
 		// Don't fail the entire process if thumbnail generation fails
 		// Just log and continue
 	} else {
-		// Upload thumbnail to storage
-		thumbnailKey := services.GenerateThumbnailKey(articleID)
-		thumbnailURL, err := p.storageService.UploadFile(context.Background(), thumbnailKey, thumbnailData, "image/png")
+		// Upload thumbnail to storage under a key derived from the content
+		thumbnail, err := p.artifacts.Put(context.Background(), services.ArtifactThumbnail, bytes.NewReader(thumbnailData), "image/png")
 		if err != nil {
 			log.Printf("Failed to upload thumbnail for article %d: %v", articleID, err)
 		} else {
-			// Save thumbnail path
-			updateQuery := `UPDATE articles SET thumbnail_path = $1, updated_at = CURRENT_TIMESTAMP
-			                WHERE id = $2`
-			if _, err := p.db.Exec(updateQuery, thumbnailURL, articleID); err != nil {
-				log.Printf("Failed to save thumbnail path for article %d: %v", articleID, err)
+			// Save thumbnail as the current rendition; URLs are signed when the article is read
+			params := map[string]interface{}{"aspect_ratio": aspectRatio}
+			if _, err := p.artifacts.Record(context.Background(), articleID, thumbnail, 0, params); err != nil {
+				log.Printf("Failed to save thumbnail for article %d: %v", articleID, err)
 			} else {
 				log.Printf("Successfully generated and uploaded thumbnail for article %d", articleID)
 			}
@@ -130,7 +184,7 @@ func (p *Processor) ProcessArticle(articleID int64) {
 			styleStr = style.String
 		}
 
-		audioPath, err := p.elevenLabsService.ConvertTextToSpeech(summary, articleID, langStr, styleStr)
+		audio, err := p.elevenLabsService.ConvertTextToSpeech(summary, langStr, styleStr)
 		if err != nil {
 			log.Printf("Failed to convert article %d to speech: %v", articleID, err)
 			p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to convert to speech: %v", err))
@@ -138,10 +192,9 @@ func (p *Processor) ProcessArticle(articleID int64) {
 			return
 		}
 
-		// Save audio file path
-		updateQuery := `UPDATE articles SET audio_file_path = $1, updated_at = CURRENT_TIMESTAMP
-		                WHERE id = $2`
-		if _, err := p.db.Exec(updateQuery, audioPath, articleID); err != nil {
+		// Save audio as the current rendition
+		params := map[string]interface{}{"language": langStr, "style": styleStr}
+		if _, err := p.artifacts.Record(context.Background(), articleID, audio, 0, params); err != nil {
 			log.Printf("Failed to save audio path for article %d: %v", articleID, err)
 			p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to save audio path: %v", err))
 			return
@@ -150,63 +203,26 @@ func (p *Processor) ProcessArticle(articleID int64) {
 		log.Printf("Successfully converted article %d to speech", articleID)
 	}
 
-	// Step 4: If format is video, generate video using Fal API (Sora 2)
+	// Step 4: If format is video, generate a storyboarded video using Fal API (Sora 2).
+	// Scenes are rendered asynchronously; the article is marked ready once Fal reports
+	// back for every scene and the clips have been stitched.
 	if format == "video" && p.falService != nil {
-		log.Printf("Generating video for article %d using Fal API (Sora 2)", articleID)
-
-		// Determine video duration based on length
-		var duration int
-		switch length {
-		case "s":
-			duration = 10 // 10 seconds for short
-		case "m":
-			duration = 30 // 30 seconds for medium
-		case "l":
-			duration = 60 // 60 seconds for long
-		default:
-			duration = 30 // default to medium
+		log.Printf("Generating storyboarded video for article %d using Fal API (Sora 2)", articleID)
+
+		langStr := ""
+		if language.Valid {
+			langStr = language.String
 		}
 
-		// Generate video from summary
-		videoURL, err := p.falService.GenerateVideo(summary, duration)
-		if err != nil {
+		if err := p.startStoryboardVideo(articleID, summary, length, langStr, aspectRatio); err != nil {
 			log.Printf("Failed to generate video for article %d: %v", articleID, err)
 			p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to generate video: %v", err))
 			p.sendFailureNotification(articleID, "Failed to generate video")
 			return
 		}
 
-		log.Printf("Video generated successfully for article %d, downloading from %s", articleID, videoURL)
-
-		// Download and save the video
-		videoPath, err := p.falService.DownloadVideo(videoURL, int(articleID))
-		if err != nil {
-			log.Printf("Failed to download video for article %d: %v", articleID, err)
-			p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to download video: %v", err))
-			p.sendFailureNotification(articleID, "Failed to download video")
-			return
-		}
-
-		// Upload video to storage
-		videoKey := services.GenerateVideoKey(articleID)
-		videoStorageURL, err := p.storageService.UploadVideoFile(context.Background(), videoKey, videoPath)
-		if err != nil {
-			log.Printf("Failed to upload video to storage for article %d: %v", articleID, err)
-			p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to upload video: %v", err))
-			p.sendFailureNotification(articleID, "Failed to upload video")
-			return
-		}
-
-		// Save video file path
-		updateQuery := `UPDATE articles SET video_file_path = $1, updated_at = CURRENT_TIMESTAMP
-		                WHERE id = $2`
-		if _, err := p.db.Exec(updateQuery, videoStorageURL, articleID); err != nil {
-			log.Printf("Failed to save video path for article %d: %v", articleID, err)
-			p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to save video path: %v", err))
-			return
-		}
-
-		log.Printf("Successfully generated and uploaded video for article %d", articleID)
+		log.Printf("Submitted video scenes for article %d, waiting for Fal to finish", articleID)
+		return
 	}
 
 	// Update status to ready
@@ -216,17 +232,46 @@ func (p *Processor) ProcessArticle(articleID int64) {
 	}
 
 	log.Printf("Successfully processed article %d", articleID)
+	p.sendReadyNotification(articleID, title)
+}
 
-	// Send push notification to Apple device
-	if p.apnsService != nil {
-		log.Printf("Sending push notification for article %d", articleID)
-		if err := p.apnsService.SendArticleReadyNotification(articleID, title); err != nil {
-			log.Printf("Failed to send push notification for article %d: %v", articleID, err)
-			// Don't fail the entire process if notification fails
-		} else {
-			log.Printf("Successfully sent push notification for article %d to device %s", articleID, p.apnsService.GetDeviceToken())
+// autoTagArticle adds the tags Gemini suggests from the user's vocabulary
+func (p *Processor) autoTagArticle(articleID int64, userID, title, summary string) error {
+	rows, err := p.db.Query(`SELECT name FROM tags WHERE user_id = $1 ORDER BY name`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load tags: %w", err)
+	}
+	var vocabulary []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan tag: %w", err)
 		}
+		vocabulary = append(vocabulary, name)
+	}
+	rows.Close()
+
+	if len(vocabulary) == 0 {
+		return nil
 	}
+
+	tags, err := p.geminiService.SuggestTags(title, summary, vocabulary)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err := p.db.Exec(`INSERT INTO article_tags (article_id, tag_id, source)
+		                     SELECT $1, id, 'auto' FROM tags WHERE user_id = $2 AND name = $3
+		                     ON CONFLICT (article_id, tag_id) DO NOTHING`, articleID, userID, tag)
+		if err != nil {
+			return fmt.Errorf("failed to add tag %q: %w", tag, err)
+		}
+	}
+
+	log.Printf("Auto-tagged article %d with %v", articleID, tags)
+	return nil
 }
 
 func (p *Processor) updateArticleStatus(articleID int64, status, errorMessage string) error {
@@ -236,13 +281,96 @@ func (p *Processor) updateArticleStatus(articleID int64, status, errorMessage st
 	return err
 }
 
+// notificationThumbnailTTL is how long the thumbnail URL in a notification
+// stays valid; notifications are delivered right away or not at all
+const notificationThumbnailTTL = time.Hour
+
+// sendReadyNotification notifies the article's owner on every channel they
+// enabled for ready articles
+func (p *Processor) sendReadyNotification(articleID int64, title string) {
+	if p.notifications == nil {
+		return
+	}
+	log.Printf("Sending ready notification for article %d", articleID)
+	userID, article, err := p.articleNotification(articleID, title)
+	if err != nil {
+		log.Printf("Failed to prepare ready notification for article %d: %v", articleID, err)
+		return
+	}
+	badge, err := p.unreadCount(userID)
+	if err != nil {
+		log.Printf("Failed to prepare ready notification for article %d: %v", articleID, err)
+		return
+	}
+	notification := services.NewArticleReadyNotification(article, badge)
+	if err := p.notifications.Notify(context.Background(), userID, notification); err != nil {
+		log.Printf("Failed to send ready notification for article %d: %v", articleID, err)
+	}
+}
+
 func (p *Processor) sendFailureNotification(articleID int64, errorMsg string) {
-	if p.apnsService != nil {
-		log.Printf("Sending failure notification for article %d", articleID)
-		if err := p.apnsService.SendArticleFailedNotification(articleID, errorMsg); err != nil {
-			log.Printf("Failed to send failure notification for article %d: %v", articleID, err)
+	if p.notifications == nil {
+		return
+	}
+	log.Printf("Sending failure notification for article %d", articleID)
+	userID, article, err := p.articleNotification(articleID, "")
+	if err != nil {
+		log.Printf("Failed to prepare failure notification for article %d: %v", articleID, err)
+		return
+	}
+	badge, err := p.unreadCount(userID)
+	if err != nil {
+		log.Printf("Failed to prepare failure notification for article %d: %v", articleID, err)
+		return
+	}
+	notification := services.NewArticleFailedNotification(article, errorMsg, badge)
+	if err := p.notifications.Notify(context.Background(), userID, notification); err != nil {
+		log.Printf("Failed to send failure notification for article %d: %v", articleID, err)
+	}
+}
+
+// articleNotification loads what a notification shows about an article, and
+// who owns it: its title (unless given), URL, format and a signed thumbnail URL
+func (p *Processor) articleNotification(articleID int64, title string) (string, services.ArticleNotification, error) {
+	article := services.ArticleNotification{ArticleID: articleID}
+
+	var userID, storedTitle string
+	var thumbnailPath sql.NullString
+	err := p.db.QueryRow(`SELECT user_id, COALESCE(title, ''), url, format, thumbnail_path FROM articles WHERE id = $1`,
+		articleID).Scan(&userID, &storedTitle, &article.URL, &article.Format, &thumbnailPath)
+	if err != nil {
+		return "", article, fmt.Errorf("failed to load article: %w", err)
+	}
+
+	article.Title = title
+	if article.Title == "" {
+		article.Title = storedTitle
+	}
+
+	if thumbnailPath.Valid && thumbnailPath.String != "" {
+		url, err := p.storageService.SignedURL(context.Background(), thumbnailPath.String, notificationThumbnailTTL)
+		if err != nil {
+			// Send the notification without the thumbnail
+			log.Printf("Failed to sign thumbnail for article %d notification: %v", articleID, err)
 		} else {
-			log.Printf("Successfully sent failure notification for article %d to device %s", articleID, p.apnsService.GetDeviceToken())
+			article.ThumbnailURL = url
 		}
 	}
+
+	return userID, article, nil
+}
+
+// unreadCount counts a user's unread articles, shown as the badge: articles
+// that are ready, in the inbox and never opened on any device
+func (p *Processor) unreadCount(userID string) (int, error) {
+	var count int
+	err := p.db.QueryRow(`SELECT COUNT(*) FROM articles a
+	                      WHERE a.user_id = $1 AND a.status = 'ready' AND NOT a.archived AND a.deleted_at IS NULL
+	                      AND NOT EXISTS (SELECT 1 FROM article_progress ap
+	                                      WHERE ap.article_id = a.id AND ap.user_id = a.user_id)`,
+		userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread articles: %w", err)
+	}
+	return count, nil
 }
@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pocketscribe/internal/services"
+)
+
+// videoWorkDirPrefix names the temporary directories video jobs download
+// scenes into, so the collector can find the ones a crash left behind
+const videoWorkDirPrefix = "pocketscribe-video-"
+
+// legacyVideoOutputDir is where the video composer wrote finished videos
+// before they were composed in work directories, relative to the server's
+// working directory. Nothing writes there anymore.
+const legacyVideoOutputDir = "uploads/videos"
+
+// StorageGCOptions configures the storage garbage collector
+type StorageGCOptions struct {
+	Interval    time.Duration // how often the collector runs
+	GracePeriod time.Duration // how old an unreferenced file must be before it is collected
+	Delete      bool          // delete unreferenced files; when false they are only reported
+}
+
+// StorageGCReport is the result of one collection
+type StorageGCReport struct {
+	Scanned          int                 // files listed under the media prefixes
+	Orphans          []services.FileInfo // files no article references, older than the grace period
+	OrphanBytes      int64
+	Deleted          int // orphans deleted; 0 when only reporting
+	TempFilesRemoved int // stale local upload files and video work directories removed
+
+	LegacyVideos     []string // videos left in legacyVideoOutputDir, older than the grace period
+	LegacyVideoBytes int64
+	LegacyDeleted    int // legacy videos deleted; 0 when only reporting
+}
+
+// StorageCollector finds files in storage that no article references:
+// renditions of purged articles, failed or interrupted uploads, and files
+// replaced before media was versioned. It reports them, or deletes them.
+type StorageCollector struct {
+	db      *sql.DB
+	storage services.Storage
+	options StorageGCOptions
+}
+
+func NewStorageCollector(db *sql.DB, storage services.Storage, options StorageGCOptions) *StorageCollector {
+	return &StorageCollector{
+		db:      db,
+		storage: storage,
+		options: options,
+	}
+}
+
+// Run collects periodically until ctx is cancelled
+func (c *StorageCollector) Run(ctx context.Context) {
+	interval := c.options.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := c.Collect(ctx)
+			if err != nil {
+				log.Printf("Storage garbage collection failed: %v", err)
+				continue
+			}
+			if c.options.Delete {
+				log.Printf("Storage garbage collection scanned %d files, deleted %d of %d unreferenced (%d bytes) and %d of %d legacy videos, removed %d temporary files",
+					report.Scanned, report.Deleted, len(report.Orphans), report.OrphanBytes, report.LegacyDeleted, len(report.LegacyVideos), report.TempFilesRemoved)
+			} else {
+				log.Printf("Storage garbage collection scanned %d files, found %d unreferenced (%d bytes) and %d legacy videos (%d bytes), removed %d temporary files",
+					report.Scanned, len(report.Orphans), report.OrphanBytes, len(report.LegacyVideos), report.LegacyVideoBytes, report.TempFilesRemoved)
+			}
+		}
+	}
+}
+
+// Collect lists the media prefixes of the bucket, cross-references every
+// file against the keys saved on articles and artifacts, and collects the
+// unreferenced files older than the grace period. Newer files may belong to
+// an upload that has not been recorded yet.
+func (c *StorageCollector) Collect(ctx context.Context) (*StorageGCReport, error) {
+	cutoff := time.Now().Add(-c.gracePeriod())
+	report := &StorageGCReport{Orphans: []services.FileInfo{}}
+
+	// List before loading references, so a file uploaded and recorded
+	// in between is never mistaken for an orphan
+	var files []services.FileInfo
+	for _, prefix := range services.ArtifactPrefixes() {
+		listed, err := c.storage.List(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+		}
+		files = append(files, listed...)
+	}
+	report.Scanned = len(files)
+
+	referenced, err := c.referencedKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if referenced[file.Key] || !file.LastModified.Before(cutoff) {
+			continue
+		}
+		report.Orphans = append(report.Orphans, file)
+		report.OrphanBytes += file.Size
+
+		if !c.options.Delete {
+			continue
+		}
+		if err := c.storage.Delete(ctx, file.Key); err != nil {
+			log.Printf("Failed to delete unreferenced file %s: %v", file.Key, err)
+			continue
+		}
+		report.Deleted++
+	}
+
+	report.TempFilesRemoved = c.removeStaleTempFiles(cutoff)
+	c.collectLegacyVideos(cutoff, report)
+	return report, nil
+}
+
+// referencedKeys returns every storage key an article or artifact points at,
+// including those of articles in the trash, which can still be restored
+func (c *StorageCollector) referencedKeys(ctx context.Context) (map[string]bool, error) {
+	rows, err := c.db.QueryContext(ctx, `SELECT storage_key FROM artifacts
+	                                     UNION SELECT thumbnail_path FROM articles WHERE thumbnail_path IS NOT NULL
+	                                     UNION SELECT audio_file_path FROM articles WHERE audio_file_path IS NOT NULL
+	                                     UNION SELECT video_file_path FROM articles WHERE video_file_path IS NOT NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load referenced keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan referenced key: %w", err)
+		}
+		keys[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load referenced keys: %w", err)
+	}
+	return keys, nil
+}
+
+// removeStaleTempFiles deletes video work directories and local upload files
+// that a crash or restart left behind, and returns how many were removed
+func (c *StorageCollector) removeStaleTempFiles(cutoff time.Time) int {
+	removed := 0
+
+	workDirs, err := filepath.Glob(filepath.Join(os.TempDir(), videoWorkDirPrefix+"*"))
+	if err != nil {
+		log.Printf("Failed to find video work directories: %v", err)
+	}
+	for _, dir := range workDirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Failed to remove video work directory %s: %v", dir, err)
+			continue
+		}
+		removed++
+	}
+
+	if local, ok := c.storage.(*services.LocalStorage); ok {
+		count, err := local.RemoveStaleUploads(cutoff)
+		if err != nil {
+			log.Printf("Failed to remove stale uploads: %v", err)
+		}
+		removed += count
+	}
+
+	return removed
+}
+
+// collectLegacyVideos finds the videos the old composer left on local disk,
+// and deletes them unless only reporting
+func (c *StorageCollector) collectLegacyVideos(cutoff time.Time, report *StorageGCReport) {
+	report.LegacyVideos = []string{}
+
+	paths, err := filepath.Glob(filepath.Join(legacyVideoOutputDir, "*.mp4"))
+	if err != nil {
+		log.Printf("Failed to find legacy videos: %v", err)
+		return
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		report.LegacyVideos = append(report.LegacyVideos, path)
+		report.LegacyVideoBytes += info.Size()
+
+		if !c.options.Delete {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to delete legacy video %s: %v", path, err)
+			continue
+		}
+		report.LegacyDeleted++
+	}
+}
+
+func (c *StorageCollector) gracePeriod() time.Duration {
+	if c.options.GracePeriod <= 0 {
+		return 24 * time.Hour
+	}
+	return c.options.GracePeriod
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// TrashOptions configures how long deleted articles stay restorable
+type TrashOptions struct {
+	Retention     time.Duration // how long an article stays in the trash before it is purged
+	PurgeInterval time.Duration // how often the purger looks for expired articles
+}
+
+// RunTrashPurger periodically purges articles that have been in the trash for
+// longer than the retention window. It blocks until ctx is cancelled.
+func (p *Processor) RunTrashPurger(ctx context.Context) {
+	interval := p.trash.PurgeInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	// Catch up on anything that expired while the server was down
+	p.purgeTrash(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.purgeTrash(ctx)
+		}
+	}
+}
+
+func (p *Processor) purgeTrash(ctx context.Context) {
+	rows, err := p.db.QueryContext(ctx, `SELECT id FROM articles
+	                                     WHERE deleted_at < NOW() - make_interval(secs => $1)
+	                                     ORDER BY deleted_at`, p.trashRetention().Seconds())
+	if err != nil {
+		log.Printf("Failed to find articles to purge: %v", err)
+		return
+	}
+
+	var articleIDs []int64
+	for rows.Next() {
+		var articleID int64
+		if err := rows.Scan(&articleID); err != nil {
+			log.Printf("Failed to scan article to purge: %v", err)
+			rows.Close()
+			return
+		}
+		articleIDs = append(articleIDs, articleID)
+	}
+	rows.Close()
+
+	for _, articleID := range articleIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := p.purgeArticle(ctx, articleID); err != nil {
+			log.Printf("Failed to purge article %d: %v", articleID, err)
+			continue
+		}
+		log.Printf("Purged article %d from the trash", articleID)
+	}
+}
+
+// purgeArticle deletes the files of every rendition of an article from
+// storage, then the article itself. Files with the same content as another
+// article's rendition share its key and are kept. The row is kept when a file
+// can't be deleted, so the next run retries.
+func (p *Processor) purgeArticle(ctx context.Context, articleID int64) error {
+	rows, err := p.db.QueryContext(ctx, `SELECT DISTINCT storage_key FROM artifacts a
+	                                     WHERE article_id = $1 AND NOT EXISTS (
+	                                       SELECT 1 FROM artifacts other
+	                                       WHERE other.storage_key = a.storage_key AND other.article_id <> $1)`, articleID)
+	if err != nil {
+		return fmt.Errorf("failed to find files: %w", err)
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan file: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find files: %w", err)
+	}
+
+	for _, key := range keys {
+		if err := p.storageService.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+	}
+
+	// Artifacts, chunks, chat threads, tags, collection entries and progress cascade
+	_, err = p.db.ExecContext(ctx, `DELETE FROM articles WHERE id = $1 AND deleted_at IS NOT NULL`, articleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete article: %w", err)
+	}
+	return nil
+}
+
+func (p *Processor) trashRetention() time.Duration {
+	if p.trash.Retention <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return p.trash.Retention
+}
@@ -0,0 +1,558 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pocketscribe/internal/services"
+)
+
+// stitchTimeout is how long a stitching claim is honored before another
+// worker may take over an article whose stitching never finished
+const stitchTimeout = 30 * time.Minute
+
+// VideoOptions configures storyboarded video generation
+type VideoOptions struct {
+	SceneConcurrency int    // scenes submitted, downloaded and narrated at once
+	MaxDuration      int    // cap on the target video duration in seconds
+	WebhookBaseURL   string // public base URL Fal calls back on; polling only when empty
+	WebhookSecret    string // key used to sign webhook callback URLs
+
+	SweepInterval   time.Duration // how often the sweeper looks for unfinished scenes
+	SweepStaleAfter time.Duration // how long to wait for a webhook before polling Fal
+	SceneTimeout    time.Duration // how long a scene may stay queued before it is failed
+}
+
+// videoDurationForLength returns the target duration in seconds of a storyboarded video
+func (p *Processor) videoDurationForLength(length string) int {
+	var duration int
+	switch length {
+	case "s":
+		duration = 12 // a couple of scenes for short
+	case "m":
+		duration = 40 // a handful of scenes for medium
+	case "l":
+		duration = 120 // long-form walkthrough for long
+	default:
+		duration = 40 // default to medium
+	}
+
+	if p.video.MaxDuration > 0 && duration > p.video.MaxDuration {
+		duration = p.video.MaxDuration
+	}
+	return duration
+}
+
+// webhooksEnabled reports whether Fal should call us back when a scene is ready
+func (p *Processor) webhooksEnabled() bool {
+	return p.video.WebhookBaseURL != "" && p.video.WebhookSecret != ""
+}
+
+// sceneWebhookURL returns the signed callback URL for a scene, or "" when webhooks are disabled
+func (p *Processor) sceneWebhookURL(articleID int64, sceneIndex int) string {
+	if !p.webhooksEnabled() {
+		return ""
+	}
+	return fmt.Sprintf("%s/webhooks/fal?article_id=%d&scene=%d&sig=%s",
+		strings.TrimRight(p.video.WebhookBaseURL, "/"),
+		articleID,
+		sceneIndex,
+		services.SignFalWebhook(p.video.WebhookSecret, articleID, sceneIndex),
+	)
+}
+
+// startStoryboardVideo turns the summary into a storyboard, stores the scenes and
+// submits each of them to Fal. The pipeline resumes in HandleSceneResult once
+// Fal reports back, either through the webhook or through the sweeper.
+func (p *Processor) startStoryboardVideo(articleID int64, summary, length, language, aspectRatio string) error {
+	duration := p.videoDurationForLength(length)
+
+	log.Printf("Generating storyboard for article %d (target %d seconds)", articleID, duration)
+	storyboard, err := p.geminiService.GenerateStoryboard(summary, duration, language, aspectRatio)
+	if err != nil {
+		return fmt.Errorf("failed to generate storyboard: %w", err)
+	}
+	log.Printf("Storyboard for article %d has %d scenes", articleID, len(storyboard.Scenes))
+
+	if err := p.saveScenes(articleID, storyboard); err != nil {
+		return fmt.Errorf("failed to save storyboard: %w", err)
+	}
+
+	errs := make([]error, len(storyboard.Scenes))
+	p.forEachScene(len(storyboard.Scenes), func(i int) {
+		if err := p.submitScene(articleID, i); err != nil {
+			errs[i] = fmt.Errorf("scene %d: %w", i, err)
+		}
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveScenes replaces any scenes stored for the article with the given storyboard
+func (p *Processor) saveScenes(articleID int64, storyboard *services.Storyboard) error {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM video_scenes WHERE article_id = $1`, articleID); err != nil {
+		return err
+	}
+
+	for i, scene := range storyboard.Scenes {
+		prompt := scene.VisualPrompt
+		if storyboard.VisualStyle != "" {
+			prompt = fmt.Sprintf("%s Visual style: %s", prompt, storyboard.VisualStyle)
+		}
+
+		insertQuery := `INSERT INTO video_scenes (article_id, scene_index, visual_prompt, narration, duration_seconds)
+		                VALUES ($1, $2, $3, $4, $5)`
+		if _, err := tx.Exec(insertQuery, articleID, i, prompt, scene.Narration, scene.DurationSeconds); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE articles SET video_stitch_started_at = NULL WHERE id = $1`, articleID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// submitScene queues a stored scene with Fal and records the request ID
+func (p *Processor) submitScene(articleID int64, sceneIndex int) error {
+	var video services.SoraGenerateRequest
+	query := `SELECT s.visual_prompt, s.duration_seconds, a.aspect_ratio, a.resolution
+	          FROM video_scenes s JOIN articles a ON a.id = s.article_id
+	          WHERE s.article_id = $1 AND s.scene_index = $2`
+	err := p.db.QueryRow(query, articleID, sceneIndex).Scan(&video.Prompt, &video.Duration, &video.AspectRatio, &video.Resolution)
+	if err != nil {
+		return fmt.Errorf("failed to load scene: %w", err)
+	}
+
+	log.Printf("Submitting scene %d for article %d (%d seconds, %s, %s)", sceneIndex, articleID, video.Duration, video.AspectRatio, video.Resolution)
+	requestID, err := p.falService.SubmitVideo(video, p.sceneWebhookURL(articleID, sceneIndex))
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `UPDATE video_scenes SET fal_request_id = $1, status = 'submitted', submitted_at = NOW(), updated_at = NOW()
+	                WHERE article_id = $2 AND scene_index = $3`
+	if _, err := p.db.Exec(updateQuery, requestID, articleID, sceneIndex); err != nil {
+		return fmt.Errorf("failed to save request ID: %w", err)
+	}
+
+	return nil
+}
+
+// HandleSceneResult records the outcome of a Fal request for a scene and resumes
+// the article's pipeline. A request that is not the scene's current one is rejected
+// with services.ErrUnknownFalRequest; results for already finished scenes are ignored,
+// so duplicate webhook deliveries and sweeper races are harmless.
+func (p *Processor) HandleSceneResult(articleID int64, sceneIndex int, requestID, videoURL, errorMessage string) error {
+	var currentRequestID sql.NullString
+	err := p.db.QueryRow(`SELECT fal_request_id FROM video_scenes WHERE article_id = $1 AND scene_index = $2`,
+		articleID, sceneIndex).Scan(&currentRequestID)
+	if err == sql.ErrNoRows || (err == nil && currentRequestID.String != requestID) {
+		return fmt.Errorf("scene %d of article %d, request %s: %w", sceneIndex, articleID, requestID, services.ErrUnknownFalRequest)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load scene: %w", err)
+	}
+
+	status := "completed"
+	if errorMessage != "" || videoURL == "" {
+		status = "failed"
+		if errorMessage == "" {
+			errorMessage = "video generation returned no video"
+		}
+	}
+
+	updateQuery := `UPDATE video_scenes SET status = $1, video_url = NULLIF($2, ''), error_message = NULLIF($3, ''), updated_at = NOW()
+	                WHERE article_id = $4 AND scene_index = $5 AND fal_request_id = $6 AND status = 'submitted'`
+	result, err := p.db.Exec(updateQuery, status, videoURL, errorMessage, articleID, sceneIndex, requestID)
+	if err != nil {
+		return fmt.Errorf("failed to update scene: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		log.Printf("Ignoring result for scene %d of article %d (request %s): scene is not waiting for a result", sceneIndex, articleID, requestID)
+		return nil
+	}
+
+	log.Printf("Scene %d for article %d %s", sceneIndex, articleID, status)
+	go p.resumeVideo(articleID)
+	return nil
+}
+
+// resumeVideo fails the article if any scene failed, or stitches the video once
+// every scene has completed
+func (p *Processor) resumeVideo(articleID int64) {
+	var total, completed, failed int
+	countQuery := `SELECT COUNT(*),
+	                      COUNT(*) FILTER (WHERE status = 'completed'),
+	                      COUNT(*) FILTER (WHERE status = 'failed')
+	               FROM video_scenes WHERE article_id = $1`
+	if err := p.db.QueryRow(countQuery, articleID).Scan(&total, &completed, &failed); err != nil {
+		log.Printf("Failed to load scenes for article %d: %v", articleID, err)
+		return
+	}
+
+	if failed > 0 {
+		var sceneError sql.NullString
+		p.db.QueryRow(`SELECT error_message FROM video_scenes WHERE article_id = $1 AND status = 'failed'
+		               ORDER BY scene_index LIMIT 1`, articleID).Scan(&sceneError)
+
+		failQuery := `UPDATE articles SET status = 'failed', error_message = $1, updated_at = NOW()
+		              WHERE id = $2 AND status = 'processing'`
+		result, err := p.db.Exec(failQuery, fmt.Sprintf("Failed to generate video: %s", sceneError.String), articleID)
+		if err != nil {
+			log.Printf("Failed to mark article %d as failed: %v", articleID, err)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected > 0 {
+			p.sendFailureNotification(articleID, "Failed to generate video")
+		}
+		return
+	}
+
+	if total == 0 || completed < total {
+		return
+	}
+
+	// Claim the article so only one worker stitches it
+	claimQuery := `UPDATE articles SET video_stitch_started_at = NOW()
+	               WHERE id = $1 AND status = 'processing'
+	                 AND (video_stitch_started_at IS NULL OR video_stitch_started_at < NOW() - make_interval(secs => $2))`
+	result, err := p.db.Exec(claimQuery, articleID, stitchTimeout.Seconds())
+	if err != nil {
+		log.Printf("Failed to claim article %d for stitching: %v", articleID, err)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return
+	}
+
+	if err := p.finishStoryboardVideo(articleID); err != nil {
+		log.Printf("Failed to finish video for article %d: %v", articleID, err)
+		p.updateArticleStatus(articleID, "failed", fmt.Sprintf("Failed to generate video: %v", err))
+		p.sendFailureNotification(articleID, "Failed to generate video")
+	}
+}
+
+// finishStoryboardVideo downloads every scene, narrates it, stitches the clips
+// in order, uploads the result and marks the article ready
+func (p *Processor) finishStoryboardVideo(articleID int64) error {
+	var title, language sql.NullString
+	var aspectRatio, resolution string
+	articleQuery := `SELECT title, language, aspect_ratio, resolution FROM articles WHERE id = $1`
+	if err := p.db.QueryRow(articleQuery, articleID).Scan(&title, &language, &aspectRatio, &resolution); err != nil {
+		return fmt.Errorf("failed to load article: %w", err)
+	}
+
+	rows, err := p.db.Query(`SELECT video_url, narration, duration_seconds FROM video_scenes
+	                         WHERE article_id = $1 ORDER BY scene_index`, articleID)
+	if err != nil {
+		return fmt.Errorf("failed to load scenes: %w", err)
+	}
+	var stored []services.StoryboardScene
+	var videoURLs []string
+	for rows.Next() {
+		var videoURL string
+		var scene services.StoryboardScene
+		if err := rows.Scan(&videoURL, &scene.Narration, &scene.DurationSeconds); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan scene: %w", err)
+		}
+		stored = append(stored, scene)
+		videoURLs = append(videoURLs, videoURL)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load scenes: %w", err)
+	}
+
+	// Keep all scene files for this article together so they are easy to clean up
+	workDir, err := os.MkdirTemp("", fmt.Sprintf("%sarticle_%d_", videoWorkDirPrefix, articleID))
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	scenes := make([]services.ComposeScene, len(stored))
+	errs := make([]error, len(stored))
+	p.forEachScene(len(stored), func(i int) {
+		composed, err := p.prepareScene(articleID, workDir, i, videoURLs[i], stored[i], language.String)
+		if err != nil {
+			errs[i] = fmt.Errorf("scene %d: %w", i, err)
+			return
+		}
+		scenes[i] = composed
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	width, height := services.VideoDimensions(aspectRatio, resolution)
+	log.Printf("Stitching %d scenes for article %d at %dx%d", len(scenes), articleID, width, height)
+
+	// Stream the stitched video from ffmpeg straight into storage
+	video, duration, err := p.composeAndUpload(scenes, width, height)
+	if err != nil {
+		return err
+	}
+
+	// Save video as the current rendition; other aspect ratios and resolutions are kept
+	params := map[string]interface{}{
+		"aspect_ratio": aspectRatio,
+		"resolution":   resolution,
+		"scenes":       len(scenes),
+	}
+	if _, err := p.artifacts.Record(context.Background(), articleID, video, duration, params); err != nil {
+		return fmt.Errorf("failed to save video: %w", err)
+	}
+
+	log.Printf("Successfully generated and uploaded video for article %d", articleID)
+
+	if err := p.updateArticleStatus(articleID, "ready", ""); err != nil {
+		log.Printf("Failed to update article %d status to ready: %v", articleID, err)
+		return nil
+	}
+
+	log.Printf("Successfully processed article %d", articleID)
+	p.sendReadyNotification(articleID, title.String)
+	return nil
+}
+
+// composeAndUpload stitches the scenes and uploads the video as ffmpeg
+// encodes it, so the whole file is never held in memory or on disk. Returns
+// where the video was stored and its duration in seconds.
+func (p *Processor) composeAndUpload(scenes []services.ComposeScene, width, height int) (*services.StoredFile, float64, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type composeResult struct {
+		duration float64
+		err      error
+	}
+
+	reader, writer := io.Pipe()
+	composed := make(chan composeResult, 1)
+	go func() {
+		duration, err := p.videoComposer.Compose(ctx, scenes, width, height, writer)
+		// Report the result before the upload sees EOF or the error
+		composed <- composeResult{duration, err}
+		writer.CloseWithError(err)
+	}()
+
+	file, err := p.artifacts.Put(ctx, services.ArtifactVideo, reader, "video/mp4")
+	if err != nil {
+		select {
+		case result := <-composed:
+			if result.err != nil {
+				return nil, 0, fmt.Errorf("failed to stitch scenes: %w", result.err)
+			}
+		default:
+			// Stop ffmpeg, nothing is reading its output any more
+			cancel()
+			reader.CloseWithError(err)
+			<-composed
+		}
+		return nil, 0, fmt.Errorf("failed to upload video: %w", err)
+	}
+
+	result := <-composed
+	if result.err != nil {
+		return nil, 0, fmt.Errorf("failed to stitch scenes: %w", result.err)
+	}
+
+	return file, result.duration, nil
+}
+
+// prepareScene downloads a generated scene and its narration into workDir
+func (p *Processor) prepareScene(articleID int64, workDir string, index int, videoURL string, scene services.StoryboardScene, language string) (services.ComposeScene, error) {
+	videoPath := filepath.Join(workDir, fmt.Sprintf("scene_%02d.mp4", index))
+	if err := p.falService.DownloadVideoTo(videoURL, videoPath); err != nil {
+		return services.ComposeScene{}, fmt.Errorf("failed to download video: %w", err)
+	}
+
+	narration, err := p.elevenLabsService.SynthesizeSpeech(scene.Narration, language)
+	if err != nil {
+		return services.ComposeScene{}, fmt.Errorf("failed to synthesize narration: %w", err)
+	}
+	defer narration.Close()
+
+	narrationPath := filepath.Join(workDir, fmt.Sprintf("scene_%02d.mp3", index))
+	if err := saveFile(narrationPath, narration); err != nil {
+		return services.ComposeScene{}, fmt.Errorf("failed to save narration: %w", err)
+	}
+
+	log.Printf("Scene %d for article %d is ready to stitch", index, articleID)
+	return services.ComposeScene{
+		VideoPath:       videoPath,
+		NarrationPath:   narrationPath,
+		DurationSeconds: scene.DurationSeconds,
+	}, nil
+}
+
+// saveFile streams r into a new file at path
+func saveFile(path string, r io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// forEachScene calls fn for every scene index, running at most SceneConcurrency at once
+func (p *Processor) forEachScene(count int, fn func(i int)) {
+	concurrency := p.video.SceneConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// RunVideoSweeper periodically polls Fal for scenes whose webhook never arrived,
+// fails scenes that have been queued for too long, and resumes articles whose
+// scenes are all done but were never stitched. It blocks until ctx is cancelled.
+func (p *Processor) RunVideoSweeper(ctx context.Context) {
+	interval := p.video.SweepInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.sweepVideoScenes()
+		}
+	}
+}
+
+type pendingScene struct {
+	articleID  int64
+	sceneIndex int
+	requestID  string
+	timedOut   bool
+}
+
+func (p *Processor) sweepVideoScenes() {
+	// Without webhooks the sweeper is the only way results arrive, so poll right away
+	staleAfter := p.video.SweepStaleAfter
+	if !p.webhooksEnabled() {
+		staleAfter = 0
+	}
+
+	timeout := p.video.SceneTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+
+	rows, err := p.db.Query(`SELECT article_id, scene_index, fal_request_id,
+	                                submitted_at < NOW() - make_interval(secs => $2)
+	                         FROM video_scenes
+	                         WHERE status = 'submitted' AND submitted_at < NOW() - make_interval(secs => $1)`,
+		staleAfter.Seconds(), timeout.Seconds())
+	if err != nil {
+		log.Printf("Video sweeper: failed to load pending scenes: %v", err)
+		return
+	}
+	var pending []pendingScene
+	for rows.Next() {
+		var scene pendingScene
+		if err := rows.Scan(&scene.articleID, &scene.sceneIndex, &scene.requestID, &scene.timedOut); err != nil {
+			log.Printf("Video sweeper: failed to scan scene: %v", err)
+			continue
+		}
+		pending = append(pending, scene)
+	}
+	rows.Close()
+
+	for _, scene := range pending {
+		status, err := p.falService.CheckStatus(scene.requestID)
+		if err != nil {
+			log.Printf("Video sweeper: failed to check scene %d of article %d: %v", scene.sceneIndex, scene.articleID, err)
+			continue
+		}
+
+		switch {
+		case status.Done:
+			err = p.HandleSceneResult(scene.articleID, scene.sceneIndex, scene.requestID, status.VideoURL, status.Error)
+		case scene.timedOut:
+			err = p.HandleSceneResult(scene.articleID, scene.sceneIndex, scene.requestID, "", fmt.Sprintf("timed out after %s", timeout))
+		}
+		if err != nil {
+			log.Printf("Video sweeper: failed to record scene %d of article %d: %v", scene.sceneIndex, scene.articleID, err)
+		}
+	}
+
+	// Resume articles whose scenes all finished but that were never stitched,
+	// e.g. because the server restarted mid-way
+	rows, err = p.db.Query(`SELECT a.id FROM articles a
+	                        WHERE a.status = 'processing' AND a.format = 'video'
+	                          AND (a.video_stitch_started_at IS NULL OR a.video_stitch_started_at < NOW() - make_interval(secs => $1))
+	                          AND EXISTS (SELECT 1 FROM video_scenes s WHERE s.article_id = a.id)
+	                          AND NOT EXISTS (SELECT 1 FROM video_scenes s WHERE s.article_id = a.id AND s.status IN ('pending', 'submitted'))`,
+		stitchTimeout.Seconds())
+	if err != nil {
+		log.Printf("Video sweeper: failed to load stalled articles: %v", err)
+		return
+	}
+	var stalled []int64
+	for rows.Next() {
+		var articleID int64
+		if err := rows.Scan(&articleID); err == nil {
+			stalled = append(stalled, articleID)
+		}
+	}
+	rows.Close()
+
+	for _, articleID := range stalled {
+		log.Printf("Video sweeper: resuming article %d", articleID)
+		go p.resumeVideo(articleID)
+	}
+}
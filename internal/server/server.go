@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
@@ -15,9 +16,11 @@ import (
 )
 
 type Server struct {
-	config *config.Config
-	db     *sql.DB
-	router *mux.Router
+	config       *config.Config
+	db           *sql.DB
+	router       *mux.Router
+	jobProcessor *jobs.Processor
+	storageGC    *jobs.StorageCollector
 }
 
 func New(cfg *config.Config, db *sql.DB) *Server {
@@ -48,48 +51,263 @@ func (s *Server) setupRoutes() {
 
 	// Article routes
 	// Initialize services
-	geminiService := services.NewGeminiService(s.config.GeminiAPIKey)
-
-	// Initialize storage service
-	storageService, err := services.NewStorageService(
-		s.config.StorageEndpoint,
-		s.config.StoragePublicURL,
-		s.config.StorageRegion,
-		s.config.StorageAccessKey,
-		s.config.StorageSecretKey,
-		s.config.StorageBucketName,
-	)
+	var llmProvider services.LLMProvider
+	if s.config.LLMProvider == "fake" {
+		llmProvider = services.NewFakeLLMProvider()
+	} else {
+		llmProvider = services.NewGeminiProvider(s.config.GeminiAPIKey)
+	}
+	geminiService := services.NewGeminiService(llmProvider, services.LLMModels{
+		Summarize: s.config.LLMModelSummarize,
+		Title:     s.config.LLMModelTitle,
+		Chat:      s.config.LLMModelChat,
+		Thumbnail: s.config.LLMModelThumbnail,
+		Embed:     s.config.LLMModelEmbed,
+
+		EmbedDimensions: s.config.EmbeddingDimensions,
+	}, services.SummarizeOptions{
+		MaxInputTokens: s.config.SummarizeMaxInputTokens,
+		ChunkTokens:    s.config.SummarizeChunkTokens,
+		Concurrency:    s.config.SummarizeConcurrency,
+	})
+
+	// Initialize storage (a private S3-compatible bucket, or a local directory served under /files/)
+	storage, err := services.NewStorage(s.config.StorageBackend, services.S3Config{
+		Endpoint:   s.config.StorageEndpoint,
+		Region:     s.config.StorageRegion,
+		AccessKey:  s.config.StorageAccessKey,
+		SecretKey:  s.config.StorageSecretKey,
+		BucketName: s.config.StorageBucketName,
+	}, s.config.AudioStoragePath, s.config.PublicBaseURL+"/files", s.config.StorageSigningSecret)
 	if err != nil {
 		panic(fmt.Sprintf("Failed to initialize storage service: %v", err))
 	}
+	if localStorage, ok := storage.(*services.LocalStorage); ok {
+		fileHandler := handlers.NewFileHandler(localStorage)
+		s.router.HandleFunc("/files/{key:.+}", fileHandler.ServeFile).Methods("GET", "HEAD")
+	}
 
-	elevenLabsService := services.NewElevenLabsService(s.config.ElevenLabsAPIKey, storageService)
+	// Generated media is stored under content-addressed keys and recorded as article artifacts
+	artifactStore := services.NewArtifactStore(s.db, storage)
+
+	elevenLabsService := services.NewElevenLabsService(s.config.ElevenLabsAPIKey, artifactStore)
 
 	// Initialize Fal service for video generation
 	falService := services.NewFalService()
+	videoComposer := services.NewVideoComposer()
+
+	// Initialize APNS service (provider tokens are signed with the .p8 key)
+	apnsService, err := services.NewAPNSService(services.APNSConfig{
+		KeyPath:        s.config.APNSKeyPath,
+		KeyID:          s.config.APNSKeyID,
+		TeamID:         s.config.APNSTeamID,
+		BundleID:       s.config.APNSBundleID,
+		Production:     s.config.APNSProduction,
+		Endpoint:       s.config.APNSEndpoint,
+		DeepLinkScheme: s.config.AppURLScheme,
+		OnEnvironment: func(ctx context.Context, token, environment string) error {
+			return services.SetDeviceEnvironment(ctx, s.db, token, environment)
+		},
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize APNS service: %v", err))
+	}
+
+	var notifiers []services.Notifier
+	if apnsService.Configured() {
+		notifiers = append(notifiers, apnsService)
+	}
+
+	// Firebase Cloud Messaging for Android devices
+	if s.config.FCMCredentialsFile != "" || s.config.FCMProjectID != "" {
+		fcmService, err := services.NewFCMService(services.FCMConfig{
+			CredentialsFile: s.config.FCMCredentialsFile,
+			ProjectID:       s.config.FCMProjectID,
+			DeepLinkScheme:  s.config.AppURLScheme,
+		})
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialize FCM service: %v", err))
+		}
+		notifiers = append(notifiers, fcmService)
+	}
+
+	// Web Push for browsers, signed with the VAPID key
+	var webPushPublicKey string
+	if s.config.VAPIDPrivateKey != "" {
+		webPushService, err := services.NewWebPushService(services.WebPushConfig{
+			PrivateKey: s.config.VAPIDPrivateKey,
+			Subject:    s.config.VAPIDSubject,
+			WebAppURL:  s.config.WebAppURL,
+		})
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialize Web Push service: %v", err))
+		}
+		webPushPublicKey = webPushService.PublicKey()
+		notifiers = append(notifiers, webPushService)
+	}
+
+	// Email over SMTP
+	if s.config.SMTPHost != "" {
+		emailService, err := services.NewEmailService(services.EmailConfig{
+			Host:      s.config.SMTPHost,
+			Port:      s.config.SMTPPort,
+			Username:  s.config.SMTPUsername,
+			Password:  s.config.SMTPPassword,
+			From:      s.config.SMTPFrom,
+			WebAppURL: s.config.WebAppURL,
+		})
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialize email service: %v", err))
+		}
+		notifiers = append(notifiers, emailService)
+	}
+
+	// Notifications go to the channels each user enabled per event
+	notificationDispatcher := services.NewNotificationDispatcher(s.db, notifiers...)
+
+	// Initialize the vector index for semantic search
+	vectorIndex, err := services.NewVectorIndex(s.db, s.config.VectorIndex)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize vector index: %v", err))
+	}
 
-	// Initialize APNS service
-	apnsService := services.NewAPNSService(
-		s.config.APNSTestToken,
-		s.config.APNSDeviceToken,
-		s.config.APNSBundleID,
-		s.config.APNSProduction,
+	jobProcessor := jobs.NewProcessor(
+		s.db,
+		geminiService,
+		elevenLabsService,
+		storage,
+		artifactStore,
+		notificationDispatcher,
+		falService,
+		videoComposer,
+		vectorIndex,
+		jobs.VideoOptions{
+			SceneConcurrency: s.config.VideoSceneConcurrency,
+			MaxDuration:      s.config.VideoMaxDuration,
+			WebhookBaseURL:   s.config.PublicBaseURL,
+			WebhookSecret:    s.config.FalWebhookSecret,
+			SweepInterval:    s.config.FalSweepInterval,
+			SweepStaleAfter:  s.config.FalSweepStaleAfter,
+			SceneTimeout:     s.config.FalSceneTimeout,
+		},
+		jobs.SearchOptions{
+			ChunkTokens: s.config.EmbedChunkTokens,
+		},
+		jobs.TrashOptions{
+			Retention:     s.config.TrashRetention,
+			PurgeInterval: s.config.TrashPurgeInterval,
+		},
+		jobs.BriefingOptions{
+			Hour: s.config.BriefingHour,
+		},
 	)
+	s.jobProcessor = jobProcessor
+
+	// Collect files in storage that no article references
+	s.storageGC = jobs.NewStorageCollector(s.db, storage, jobs.StorageGCOptions{
+		Interval:    s.config.StorageGCInterval,
+		GracePeriod: s.config.StorageGCGracePeriod,
+		Delete:      s.config.StorageGCDelete,
+	})
 
-	jobProcessor := jobs.NewProcessor(s.db, geminiService, elevenLabsService, storageService, apnsService, falService)
+	// Fal webhook routes (authenticated by signed callback URLs, not user tokens)
+	falWebhookHandler := handlers.NewFalWebhookHandler(s.config.FalWebhookSecret, jobProcessor)
+	s.router.HandleFunc("/webhooks/fal", falWebhookHandler.HandleFalWebhook).Methods("POST")
 
-	articleHandler := handlers.NewArticleHandler(s.db, jobProcessor)
+	// Media URLs are signed on every read and expire
+	mediaURLs := handlers.NewMediaURLs(storage, s.config.StorageURLTTL, s.config.StorageThumbnailURLTTL)
+
+	articleHandler := handlers.NewArticleHandler(s.db, jobProcessor, falService, mediaURLs)
 	api.HandleFunc("/articles", articleHandler.CreateArticle).Methods("POST")
 	api.HandleFunc("/articles", articleHandler.GetArticles).Methods("GET")
 	api.HandleFunc("/articles/{id}", articleHandler.GetArticle).Methods("GET")
+	api.HandleFunc("/articles/{id}", articleHandler.UpdateArticle).Methods("PATCH")
 	api.HandleFunc("/articles/{id}", articleHandler.DeleteArticle).Methods("DELETE")
 
+	// Media routes (streamed from storage for clients that can't reach it directly)
+	mediaHandler := handlers.NewMediaHandler(s.db, storage, s.config.MediaCacheMaxAge)
+	api.HandleFunc("/articles/{id}/media/{kind}", mediaHandler.GetMedia).Methods("GET", "HEAD")
+
+	// Artifact routes (every stored rendition of an article's media)
+	artifactHandler := handlers.NewArtifactHandler(s.db, artifactStore, articleHandler)
+	api.HandleFunc("/articles/{id}/artifacts", artifactHandler.GetArtifacts).Methods("GET")
+	api.HandleFunc("/articles/{id}/artifacts/{artifactId}/current", artifactHandler.SetCurrentArtifact).Methods("PUT")
+
+	// Device routes (push notification tokens)
+	deviceHandler := handlers.NewDeviceHandler(s.db)
+	api.HandleFunc("/devices", deviceHandler.GetDevices).Methods("GET")
+	api.HandleFunc("/devices", deviceHandler.RegisterDevice).Methods("POST")
+	api.HandleFunc("/devices", deviceHandler.UnregisterDevice).Methods("DELETE")
+	api.HandleFunc("/devices/{token}", deviceHandler.UnregisterDevice).Methods("DELETE")
+
+	// Notification preference routes
+	channels := make([]string, 0, len(notifiers))
+	for _, notifier := range notifiers {
+		channels = append(channels, notifier.Channel())
+	}
+	notificationHandler := handlers.NewNotificationHandler(s.db, channels, webPushPublicKey)
+	api.HandleFunc("/notifications/preferences", notificationHandler.GetPreferences).Methods("GET")
+	api.HandleFunc("/notifications/preferences", notificationHandler.UpdatePreferences).Methods("PUT")
+	api.HandleFunc("/notifications/web-push-key", notificationHandler.GetWebPushKey).Methods("GET")
+
+	// Trash routes
+	trashHandler := handlers.NewTrashHandler(s.db, articleHandler, s.config.TrashRetention)
+	api.HandleFunc("/trash", trashHandler.GetTrash).Methods("GET")
+	api.HandleFunc("/articles/{id}/restore", trashHandler.RestoreArticle).Methods("POST")
+
+	// Progress routes
+	progressHandler := handlers.NewProgressHandler(s.db)
+	api.HandleFunc("/articles/{id}/progress", progressHandler.UpdateProgress).Methods("PUT")
+	api.HandleFunc("/articles/{id}/progress", progressHandler.GetProgress).Methods("GET")
+
+	// Tag routes
+	tagHandler := handlers.NewTagHandler(s.db)
+	api.HandleFunc("/tags", tagHandler.GetTags).Methods("GET")
+	api.HandleFunc("/tags", tagHandler.CreateTag).Methods("POST")
+	api.HandleFunc("/tags/{tagId}", tagHandler.UpdateTag).Methods("PATCH")
+	api.HandleFunc("/tags/{tagId}", tagHandler.DeleteTag).Methods("DELETE")
+	api.HandleFunc("/articles/{id}/tags", tagHandler.SetArticleTags).Methods("PUT")
+
+	// Collection routes
+	collectionHandler := handlers.NewCollectionHandler(s.db, articleHandler)
+	api.HandleFunc("/collections", collectionHandler.GetCollections).Methods("GET")
+	api.HandleFunc("/collections", collectionHandler.CreateCollection).Methods("POST")
+	api.HandleFunc("/collections/{collectionId}", collectionHandler.GetCollection).Methods("GET")
+	api.HandleFunc("/collections/{collectionId}", collectionHandler.UpdateCollection).Methods("PATCH")
+	api.HandleFunc("/collections/{collectionId}", collectionHandler.DeleteCollection).Methods("DELETE")
+	api.HandleFunc("/collections/{collectionId}/articles", collectionHandler.AddArticle).Methods("POST")
+	api.HandleFunc("/collections/{collectionId}/articles/{articleId}", collectionHandler.RemoveArticle).Methods("DELETE")
+
 	// Chat routes
 	chatHandler := handlers.NewChatHandler(s.db, geminiService)
 	api.HandleFunc("/articles/{id}/chat", chatHandler.ChatWithArticle).Methods("POST")
+	api.HandleFunc("/articles/{id}/chat/threads", chatHandler.CreateThread).Methods("POST")
+	api.HandleFunc("/articles/{id}/chat/threads", chatHandler.GetThreads).Methods("GET")
+	api.HandleFunc("/articles/{id}/chat/threads/{threadId}", chatHandler.GetThread).Methods("GET")
+	api.HandleFunc("/articles/{id}/chat/threads/{threadId}", chatHandler.DeleteThread).Methods("DELETE")
+
+	// Library-wide search and chat routes
+	searchHandler := handlers.NewSearchHandler(vectorIndex, geminiService)
+	api.HandleFunc("/search", searchHandler.Search).Methods("GET")
+	api.HandleFunc("/chat", searchHandler.ChatWithLibrary).Methods("POST")
 }
 
 func (s *Server) Start() error {
+	// Poll Fal for video scenes whose webhook never arrived
+	go s.jobProcessor.RunVideoSweeper(context.Background())
+
+	// Index articles saved before semantic search was available
+	go s.jobProcessor.BackfillEmbeddings(context.Background())
+
+	// Purge articles that have been in the trash past the retention window
+	go s.jobProcessor.RunTrashPurger(context.Background())
+
+	// Report or delete files in storage that no article references
+	go s.storageGC.Run(context.Background())
+
+	// Send the daily briefing to users who enabled it
+	go s.jobProcessor.RunDailyBriefings(context.Background())
+
 	addr := fmt.Sprintf(":%s", s.config.Port)
 	return http.ListenAndServe(addr, s.router)
 }
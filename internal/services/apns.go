@@ -2,32 +2,94 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"golang.org/x/net/http2"
 )
 
+// APNs hosts
+const (
+	apnsProductionEndpoint = "https://api.push.apple.com"
+	apnsSandboxEndpoint    = "https://api.sandbox.push.apple.com"
+)
+
 type APNSService struct {
-	token       string
-	bundleID    string
-	production  bool
-	deviceToken string
-	client      *http.Client
+	signer             *apnsTokenSigner
+	bundleID           string
+	production         bool
+	productionEndpoint string
+	sandboxEndpoint    string
+	deepLinkScheme     string
+	onEnvironment      func(ctx context.Context, token, environment string) error
+	client             *http.Client
+}
+
+// APNSConfig configures token-based authentication with APNs
+type APNSConfig struct {
+	KeyPath    string // .p8 signing key from the Apple Developer account
+	Key        []byte // contents of the .p8 key; read from KeyPath when empty
+	KeyID      string
+	TeamID     string
+	BundleID   string
+	Production bool // default environment for devices that don't report one
+
+	// DeepLinkScheme is the app's URL scheme, for deep links such as
+	// pocketscribe://articles/42
+	DeepLinkScheme string
+
+	// OnEnvironment is called when a device's token is rejected as
+	// BadDeviceToken but accepted by the other environment, so the device can
+	// be stored with the environment it belongs to
+	OnEnvironment func(ctx context.Context, token, environment string) error
+
+	// Endpoint replaces the APNs host for every device, e.g. with a local
+	// HTTP/2 stub in tests. Client replaces the HTTP/2 client used to reach it.
+	Endpoint string
+	Client   *http.Client
 }
 
+// Notification categories. The app registers each with its actions:
+// ARTICLE_READY_PLAYABLE with "Play now" (PLAY_NOW) and "Archive" (ARCHIVE),
+// ARTICLE_READY with "Archive", and ARTICLE_FAILED and DAILY_BRIEFING with none.
+const (
+	APNSCategoryArticleReady         = "ARTICLE_READY"
+	APNSCategoryArticleReadyPlayable = "ARTICLE_READY_PLAYABLE"
+	APNSCategoryArticleFailed        = "ARTICLE_FAILED"
+	APNSCategoryDailyBriefing        = "DAILY_BRIEFING"
+)
+
+// Notification threads, so the app groups each kind of notification apart
+const (
+	apnsThreadArticleReady  = "article-ready"
+	apnsThreadArticleFailed = "article-failed"
+	apnsThreadDailyBriefing = "daily-briefing"
+)
+
+// APNSPayload is the aps dictionary plus the custom keys the app reads to
+// open the article the notification is about
 type APNSPayload struct {
-	APS APSData `json:"aps"`
+	APS          APSData `json:"aps"`
+	ArticleID    int64   `json:"article_id,omitempty"`
+	Format       string  `json:"format,omitempty"`
+	DeepLink     string  `json:"deep_link,omitempty"`
+	ThumbnailURL string  `json:"thumbnail_url,omitempty"` // attached by the app's notification service extension
 }
 
 type APSData struct {
-	Alert APSAlert `json:"alert"`
-	Badge int      `json:"badge,omitempty"`
-	Sound string   `json:"sound,omitempty"`
+	Alert          APSAlert `json:"alert"`
+	Badge          *int     `json:"badge,omitempty"` // 0 clears the badge, nil leaves it alone
+	Sound          string   `json:"sound,omitempty"`
+	Category       string   `json:"category,omitempty"`
+	ThreadID       string   `json:"thread-id,omitempty"`
+	MutableContent int      `json:"mutable-content,omitempty"`
 }
 
 type APSAlert struct {
@@ -36,78 +98,127 @@ type APSAlert struct {
 	Subtitle string `json:"subtitle,omitempty"`
 }
 
-// NewAPNSService creates a new APNS service with a static token
-func NewAPNSService(token, deviceToken, bundleID string, production bool) *APNSService {
-	production = false
+// NewAPNSService creates a new APNS service that signs its own provider
+// tokens with the .p8 key. Without a key, sending fails; check Configured
+// before using the service.
+func NewAPNSService(cfg APNSConfig) (*APNSService, error) {
+	var signer *apnsTokenSigner
+	key := cfg.Key
+	if len(key) == 0 && cfg.KeyPath != "" {
+		var err error
+		key, err = os.ReadFile(cfg.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read APNs key: %w", err)
+		}
+	}
+	if len(key) > 0 {
+		var err error
+		signer, err = newAPNSTokenSigner(key, cfg.KeyID, cfg.TeamID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Create HTTP/2 client
-	transport := &http2.Transport{
-		TLSClientConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		},
+	client := cfg.Client
+	if client == nil {
+		// Create HTTP/2 client
+		transport := &http2.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+
+		client = &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+		}
 	}
 
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   10 * time.Second,
+	deepLinkScheme := cfg.DeepLinkScheme
+	if deepLinkScheme == "" {
+		deepLinkScheme = "pocketscribe"
 	}
 
-	return &APNSService{
-		token:       token,
-		bundleID:    bundleID,
-		production:  production,
-		deviceToken: deviceToken,
-		client:      client,
+	productionEndpoint, sandboxEndpoint := apnsProductionEndpoint, apnsSandboxEndpoint
+	if cfg.Endpoint != "" {
+		productionEndpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+		sandboxEndpoint = productionEndpoint
 	}
+
+	return &APNSService{
+		signer:             signer,
+		bundleID:           cfg.BundleID,
+		production:         cfg.Production,
+		productionEndpoint: productionEndpoint,
+		sandboxEndpoint:    sandboxEndpoint,
+		deepLinkScheme:     deepLinkScheme,
+		onEnvironment:      cfg.OnEnvironment,
+		client:             client,
+	}, nil
 }
 
-// SendArticleReadyNotification sends a push notification when an article is ready
-func (s *APNSService) SendArticleReadyNotification(articleID int64, title string) error {
-	// Construct the payload
-	payload := APNSPayload{
-		APS: APSData{
-			Alert: APSAlert{
-				Title: "Article Ready!",
-				Body:  fmt.Sprintf("Your article '%s' is ready to read", title),
-			},
-			Badge: 1,
-			Sound: "default",
-		},
-	}
+// Configured reports whether a signing key is configured
+func (s *APNSService) Configured() bool {
+	return s.signer != nil
+}
 
-	return s.sendNotification(payload)
+// Channel returns ChannelAPNs
+func (s *APNSService) Channel() string {
+	return ChannelAPNs
 }
 
-// SendArticleFailedNotification sends a push notification when an article fails
-func (s *APNSService) SendArticleFailedNotification(articleID int64, errorMsg string) error {
+// Notify sends a notification to a device. Audio and video articles get the
+// "Play now" action, and the thumbnail is attached when the article has one.
+func (s *APNSService) Notify(ctx context.Context, device Recipient, notification Notification) error {
+	badge := notification.Badge
 	payload := APNSPayload{
 		APS: APSData{
 			Alert: APSAlert{
-				Title: "Article Processing Failed",
-				Body:  "There was an error processing your article",
+				Title:    notification.Title,
+				Subtitle: notification.Subtitle,
+				Body:     notification.Body,
 			},
+			Badge: &badge,
 			Sound: "default",
 		},
 	}
 
-	return s.sendNotification(payload)
-}
-
-// sendNotification sends the actual push notification to APNS
-func (s *APNSService) sendNotification(payload APNSPayload) error {
-	// Skip if no token configured (graceful degradation)
-	if s.token == "" {
-		log.Printf("APNS: No token configured, skipping push notification")
-		return nil
+	switch notification.Event {
+	case EventArticleReady:
+		payload.APS.Category = APNSCategoryArticleReady
+		if article := notification.Article; article != nil && (article.Format == "audio" || article.Format == "video") {
+			payload.APS.Category = APNSCategoryArticleReadyPlayable
+		}
+		payload.APS.ThreadID = apnsThreadArticleReady
+	case EventArticleFailed:
+		payload.APS.Category = APNSCategoryArticleFailed
+		payload.APS.ThreadID = apnsThreadArticleFailed
+	case EventDailyBriefing:
+		payload.APS.Category = APNSCategoryDailyBriefing
+		payload.APS.ThreadID = apnsThreadDailyBriefing
 	}
 
-	// Determine APNS endpoint
-	endpoint := "https://api.sandbox.push.apple.com"
-	if s.production {
-		endpoint = "https://api.push.apple.com"
+	if article := notification.Article; article != nil {
+		payload.ArticleID = article.ArticleID
+		payload.Format = article.Format
+		payload.DeepLink = fmt.Sprintf("%s://articles/%d", s.deepLinkScheme, article.ArticleID)
+		if article.ThumbnailURL != "" && notification.Event == EventArticleReady {
+			// Let the app's notification service extension download the thumbnail
+			payload.APS.MutableContent = 1
+			payload.ThumbnailURL = article.ThumbnailURL
+		}
+	} else {
+		payload.DeepLink = fmt.Sprintf("%s://articles", s.deepLinkScheme)
 	}
 
-	url := fmt.Sprintf("%s/3/device/%s", endpoint, s.deviceToken)
+	return s.sendNotification(ctx, device, payload)
+}
+
+// sendNotification sends the actual push notification to APNS
+func (s *APNSService) sendNotification(ctx context.Context, device Recipient, payload APNSPayload) error {
+	if s.signer == nil {
+		return fmt.Errorf("APNs signing key is not configured")
+	}
 
 	// Marshal payload
 	payloadBytes, err := json.Marshal(payload)
@@ -115,10 +226,61 @@ func (s *APNSService) sendNotification(payload APNSPayload) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
+	providerToken, err := s.signer.Token()
+	if err != nil {
+		return err
+	}
+
+	reason, err := s.post(ctx, device, payloadBytes, providerToken)
+	if reason == "ExpiredProviderToken" {
+		// Sign a new token and try once more
+		s.signer.Invalidate(providerToken)
+		if providerToken, err = s.signer.Token(); err != nil {
+			return err
+		}
+		reason, err = s.post(ctx, device, payloadBytes, providerToken)
+	}
+	if reason == "BadDeviceToken" {
+		// Development builds get sandbox tokens and release builds production
+		// ones; try the other environment before giving up on the device
+		other := device
+		other.Environment = "production"
+		if s.environment(device) == "production" {
+			other.Environment = "sandbox"
+		}
+		if s.deviceEndpoint(other) == s.deviceEndpoint(device) {
+			return fmt.Errorf("%w: %v", ErrDeviceTokenInvalid, err)
+		}
+
+		if reason, err = s.post(ctx, other, payloadBytes, providerToken); reason == "BadDeviceToken" {
+			return fmt.Errorf("%w: APNS rejected the token in both environments: %v", ErrDeviceTokenInvalid, err)
+		}
+		if err == nil {
+			log.Printf("APNS: Device %s belongs to the %s environment", device.Address, other.Environment)
+			if s.onEnvironment != nil {
+				if err := s.onEnvironment(ctx, device.Address, other.Environment); err != nil {
+					log.Printf("APNS: Failed to store the environment of device %s: %v", device.Address, err)
+				}
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("APNS: Successfully sent notification to device %s", device.Address)
+	return nil
+}
+
+// post sends a payload to a device, returning the reason APNs gave when it
+// rejected the request
+func (s *APNSService) post(ctx context.Context, device Recipient, payload []byte, providerToken string) (string, error) {
+	url := fmt.Sprintf("%s/3/device/%s", s.deviceEndpoint(device), device.Address)
+
 	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
@@ -126,28 +288,52 @@ func (s *APNSService) sendNotification(payload APNSPayload) error {
 	req.Header.Set("apns-push-type", "alert")
 	req.Header.Set("apns-priority", "10")
 	req.Header.Set("apns-expiration", "0")
-	req.Header.Set("authorization", fmt.Sprintf("bearer %s", s.token))
+	req.Header.Set("authorization", fmt.Sprintf("bearer %s", providerToken))
 
 	// Send request using HTTP/2 client
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send notification: %w", err)
+		return "", fmt.Errorf("failed to send notification: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check response
 	if resp.StatusCode != http.StatusOK {
-		var errorResponse map[string]interface{}
+		var errorResponse struct {
+			Reason string `json:"reason"`
+		}
 		json.NewDecoder(resp.Body).Decode(&errorResponse)
-		log.Printf("APNS: Failed to send notification. Status: %d, Response: %+v", resp.StatusCode, errorResponse)
-		return fmt.Errorf("APNS returned status %d: %v", resp.StatusCode, errorResponse)
+		log.Printf("APNS: Failed to send notification. Status: %d, Reason: %s", resp.StatusCode, errorResponse.Reason)
+
+		// The token will never work again, the caller should forget it. A
+		// BadDeviceToken may be from the other environment, which
+		// sendNotification tries first.
+		if resp.StatusCode == http.StatusGone || errorResponse.Reason == "Unregistered" {
+			return errorResponse.Reason, fmt.Errorf("%w: APNS returned status %d: %s", ErrDeviceTokenInvalid, resp.StatusCode, errorResponse.Reason)
+		}
+		return errorResponse.Reason, fmt.Errorf("APNS returned status %d: %s", resp.StatusCode, errorResponse.Reason)
 	}
 
-	log.Printf("APNS: Successfully sent notification to device %s", s.deviceToken)
-	return nil
+	return "", nil
 }
 
-// GetDeviceToken returns the hardcoded device token
-func (s *APNSService) GetDeviceToken() string {
-	return s.deviceToken
+// environment returns the APNs environment a device is notified in: the one
+// it registered with, or the service default
+func (s *APNSService) environment(device Recipient) string {
+	if device.Environment != "" {
+		return device.Environment
+	}
+	if s.production {
+		return "production"
+	}
+	return "sandbox"
+}
+
+// deviceEndpoint returns the APNs host of the environment that issued the
+// device's token
+func (s *APNSService) deviceEndpoint(device Recipient) string {
+	if s.environment(device) == "production" {
+		return s.productionEndpoint
+	}
+	return s.sandboxEndpoint
 }
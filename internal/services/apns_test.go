@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// apnsStub is a local HTTP/2 APNs endpoint that records the provider tokens
+// it receives and answers with the queued responses, then 200
+type apnsStub struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	tokens    []string
+	paths     []string
+	responses []apnsStubResponse
+}
+
+type apnsStubResponse struct {
+	status int
+	reason string
+}
+
+func newAPNSStub(t *testing.T) *apnsStub {
+	stub := &apnsStub{}
+	stub.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("APNs request used HTTP/%d, want HTTP/2", r.ProtoMajor)
+		}
+
+		stub.mu.Lock()
+		stub.tokens = append(stub.tokens, strings.TrimPrefix(r.Header.Get("authorization"), "bearer "))
+		stub.paths = append(stub.paths, r.URL.Path)
+		response := apnsStubResponse{status: http.StatusOK}
+		if len(stub.responses) > 0 {
+			response = stub.responses[0]
+			stub.responses = stub.responses[1:]
+		}
+		stub.mu.Unlock()
+
+		w.WriteHeader(response.status)
+		if response.reason != "" {
+			json.NewEncoder(w).Encode(map[string]string{"reason": response.reason})
+		}
+	}))
+	stub.server.EnableHTTP2 = true
+	stub.server.StartTLS()
+	t.Cleanup(stub.server.Close)
+	return stub
+}
+
+func (s *apnsStub) respond(responses ...apnsStubResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+func (s *apnsStub) receivedTokens() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokens...)
+}
+
+// newTestAPNSService creates an APNs service with a fresh .p8 key that sends
+// to the stub
+func newTestAPNSService(t *testing.T, stub *apnsStub) (*APNSService, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service, err := NewAPNSService(APNSConfig{
+		Key:      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		KeyID:    "ABC123DEFG",
+		TeamID:   "TEAM123456",
+		BundleID: "com.example.pocketscribe",
+		Endpoint: stub.server.URL,
+		Client:   stub.server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, key
+}
+
+// sendTestNotification sends an article notification to the device abcd
+func sendTestNotification(service *APNSService) error {
+	return service.Notify(context.Background(), Recipient{Address: "abcd"}, NewArticleReadyNotification(ArticleNotification{ArticleID: 42, Title: "Title", Format: "audio"}, 1))
+}
+
+func TestAPNSProviderToken(t *testing.T) {
+	stub := newAPNSStub(t)
+	service, key := newTestAPNSService(t, stub)
+
+	before := time.Now().Unix()
+	if err := sendTestNotification(service); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	tokens := stub.receivedTokens()
+	if len(tokens) != 1 {
+		t.Fatalf("got %d requests, want 1", len(tokens))
+	}
+	if stub.paths[0] != "/3/device/abcd" {
+		t.Errorf("path = %q, want /3/device/abcd", stub.paths[0])
+	}
+
+	parts := strings.Split(tokens[0], ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWT", tokens[0])
+	}
+
+	var header map[string]string
+	decodeJWTPart(t, parts[0], &header)
+	if header["alg"] != "ES256" || header["kid"] != "ABC123DEFG" {
+		t.Errorf("header = %v, want alg ES256 and kid ABC123DEFG", header)
+	}
+
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+	}
+	decodeJWTPart(t, parts[1], &claims)
+	if claims.Iss != "TEAM123456" {
+		t.Errorf("iss = %q, want TEAM123456", claims.Iss)
+	}
+	if claims.Iat < before || claims.Iat > time.Now().Unix() {
+		t.Errorf("iat = %d, want the time the token was signed", claims.Iat)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(signature) != 64 {
+		t.Fatalf("signature is not a 64-byte JWS signature: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+		t.Error("token signature does not verify with the .p8 key")
+	}
+}
+
+func TestAPNSProviderTokenReused(t *testing.T) {
+	stub := newAPNSStub(t)
+	service, _ := newTestAPNSService(t, stub)
+
+	for i := 0; i < 3; i++ {
+		if err := sendTestNotification(service); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	tokens := stub.receivedTokens()
+	if tokens[0] != tokens[1] || tokens[1] != tokens[2] {
+		t.Error("provider token was signed again within its lifetime")
+	}
+
+	// A token past its lifetime is replaced
+	service.signer.issuedAt = time.Now().Add(-apnsTokenLifetime)
+	if err := sendTestNotification(service); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if tokens := stub.receivedTokens(); tokens[3] == tokens[0] {
+		t.Error("provider token was reused past its lifetime")
+	}
+}
+
+func TestAPNSExpiredProviderTokenRetried(t *testing.T) {
+	stub := newAPNSStub(t)
+	service, _ := newTestAPNSService(t, stub)
+	stub.respond(apnsStubResponse{status: http.StatusForbidden, reason: "ExpiredProviderToken"})
+
+	if err := sendTestNotification(service); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	tokens := stub.receivedTokens()
+	if len(tokens) != 2 {
+		t.Fatalf("got %d requests, want the rejected one and one retry", len(tokens))
+	}
+	if tokens[0] == tokens[1] {
+		t.Error("retry reused the expired provider token")
+	}
+
+	// Only one retry
+	stub.respond(
+		apnsStubResponse{status: http.StatusForbidden, reason: "ExpiredProviderToken"},
+		apnsStubResponse{status: http.StatusForbidden, reason: "ExpiredProviderToken"},
+	)
+	if err := sendTestNotification(service); err == nil {
+		t.Error("sent although the retry was rejected")
+	}
+	if got := len(stub.receivedTokens()); got != 4 {
+		t.Errorf("got %d requests, want 4", got)
+	}
+}
+
+// newTestAPNSEnvironments creates an APNs service that sends to one stub for
+// the sandbox, the default environment, and to another for production
+func newTestAPNSEnvironments(t *testing.T) (service *APNSService, sandbox, production *apnsStub) {
+	sandbox = newAPNSStub(t)
+	production = newAPNSStub(t)
+	service, _ = newTestAPNSService(t, sandbox)
+	service.productionEndpoint = production.server.URL
+	return service, sandbox, production
+}
+
+func TestAPNSInvalidDeviceToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		response apnsStubResponse
+		other    apnsStubResponse // answer of the other environment; zero when it must not be tried
+		invalid  bool
+	}{
+		{"gone", apnsStubResponse{status: http.StatusGone, reason: "Unregistered"}, apnsStubResponse{}, true},
+		{"unregistered", apnsStubResponse{status: http.StatusBadRequest, reason: "Unregistered"}, apnsStubResponse{}, true},
+		{"bad device token in both environments", apnsStubResponse{status: http.StatusBadRequest, reason: "BadDeviceToken"}, apnsStubResponse{status: http.StatusBadRequest, reason: "BadDeviceToken"}, true},
+		{"bad device token, other environment fails", apnsStubResponse{status: http.StatusBadRequest, reason: "BadDeviceToken"}, apnsStubResponse{status: http.StatusInternalServerError, reason: "InternalServerError"}, false},
+		{"server error", apnsStubResponse{status: http.StatusInternalServerError, reason: "InternalServerError"}, apnsStubResponse{}, false},
+		{"too many requests", apnsStubResponse{status: http.StatusTooManyRequests, reason: "TooManyRequests"}, apnsStubResponse{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, sandbox, production := newTestAPNSEnvironments(t)
+			service.onEnvironment = func(ctx context.Context, token, environment string) error {
+				t.Errorf("stored environment %s for a token no environment accepted", environment)
+				return nil
+			}
+			sandbox.respond(tt.response)
+			if tt.other.status != 0 {
+				production.respond(tt.other)
+			}
+
+			err := sendTestNotification(service)
+			if err == nil {
+				t.Fatal("sent, want an error")
+			}
+			if errors.Is(err, ErrDeviceTokenInvalid) != tt.invalid {
+				t.Errorf("errors.Is(%v, ErrDeviceTokenInvalid) = %v, want %v", err, !tt.invalid, tt.invalid)
+			}
+
+			tried := len(production.receivedTokens()) > 0
+			if tried != (tt.other.status != 0) {
+				t.Errorf("other environment tried = %v, want %v", tried, !tried)
+			}
+		})
+	}
+}
+
+func TestAPNSDeviceEnvironmentFound(t *testing.T) {
+	service, sandbox, production := newTestAPNSEnvironments(t)
+	sandbox.respond(apnsStubResponse{status: http.StatusBadRequest, reason: "BadDeviceToken"})
+
+	var storedToken, storedEnvironment string
+	service.onEnvironment = func(ctx context.Context, token, environment string) error {
+		storedToken, storedEnvironment = token, environment
+		return nil
+	}
+
+	// The device is kept: only ErrDeviceTokenInvalid makes the dispatcher remove it
+	if err := sendTestNotification(service); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if got := len(production.receivedTokens()); got != 1 {
+		t.Fatalf("production received %d requests, want 1", got)
+	}
+	if storedToken != "abcd" || storedEnvironment != "production" {
+		t.Errorf("stored environment %q for %q, want production for abcd", storedEnvironment, storedToken)
+	}
+}
+
+func TestAPNSDeviceEndpoint(t *testing.T) {
+	tests := []struct {
+		production  bool
+		environment string
+		want        string
+	}{
+		{false, "", apnsSandboxEndpoint},
+		{true, "", apnsProductionEndpoint},
+		{true, "sandbox", apnsSandboxEndpoint},
+		{false, "production", apnsProductionEndpoint},
+	}
+
+	for _, tt := range tests {
+		service, err := NewAPNSService(APNSConfig{Production: tt.production})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := service.deviceEndpoint(Recipient{Environment: tt.environment}); got != tt.want {
+			t.Errorf("production=%v, environment %q: endpoint = %s, want %s", tt.production, tt.environment, got, tt.want)
+		}
+	}
+}
+
+func decodeJWTPart(t *testing.T, part string, v interface{}) {
+	t.Helper()
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		t.Fatalf("failed to decode JWT part: %v", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("failed to parse JWT part: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// apnsTokenLifetime is how long a provider token is reused before a new one
+// is signed. APNs rejects tokens older than an hour, and throttles providers
+// that sign new ones more often than every 20 minutes.
+const apnsTokenLifetime = 50 * time.Minute
+
+// apnsTokenSigner signs the ES256 provider tokens APNs authenticates
+// requests with, using the .p8 signing key from the Apple Developer account
+type apnsTokenSigner struct {
+	key    *ecdsa.PrivateKey
+	keyID  string
+	teamID string
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func newAPNSTokenSigner(keyPEM []byte, keyID, teamID string) (*apnsTokenSigner, error) {
+	key, err := parseAPNSKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if keyID == "" || teamID == "" {
+		return nil, fmt.Errorf("APNs key ID and team ID are required")
+	}
+
+	return &apnsTokenSigner{
+		key:    key,
+		keyID:  keyID,
+		teamID: teamID,
+	}, nil
+}
+
+// Token returns the current provider token, signing a new one when it is
+// about to expire
+func (s *apnsTokenSigner) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Since(s.issuedAt) < apnsTokenLifetime {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	token, err := s.sign(now)
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.issuedAt = now
+	return token, nil
+}
+
+// Invalidate drops token if it is still the current one, so the next request
+// signs a new one. It is called when APNs rejects a token as expired.
+func (s *apnsTokenSigner) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// sign builds a JWT with the key ID in the header and the team ID as issuer
+func (s *apnsTokenSigner) sign(issuedAt time.Time) (string, error) {
+	return signES256JWT(s.key, map[string]string{"alg": "ES256", "kid": s.keyID},
+		map[string]interface{}{"iss": s.teamID, "iat": issuedAt.Unix()})
+}
+
+// signES256JWT builds a JWT signed with a P-256 key
+func signES256JWT(key *ecdsa.PrivateKey, header map[string]string, claims map[string]interface{}) (string, error) {
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal token claims: %w", err)
+	}
+
+	message := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(message))
+
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	// JWS signatures are r and s as fixed-size big-endian integers, not ASN.1
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	return message + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parseAPNSKey parses the PKCS #8 P-256 key of a .p8 file
+func parseAPNSKey(keyPEM []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("APNs key is not PEM encoded")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse APNs key: %w", err)
+	}
+
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok || key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("APNs key must be a P-256 ECDSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+)
+
+// Artifact kinds
+const (
+	ArtifactAudio     = "audio"
+	ArtifactThumbnail = "thumbnail"
+	ArtifactVideo     = "video"
+)
+
+// ErrArtifactNotFound is returned when an artifact does not exist for the article
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// artifactKind describes where the files of a kind live
+type artifactKind struct {
+	prefix    string // storage key prefix
+	extension string
+	column    string // articles column holding the key of the current artifact
+}
+
+// uploadPrefix is where files are staged while they are uploaded and hashed
+const uploadPrefix = "uploads"
+
+var artifactKinds = map[string]artifactKind{
+	ArtifactAudio:     {prefix: "audio", extension: "mp3", column: "audio_file_path"},
+	ArtifactThumbnail: {prefix: "thumbnails", extension: "png", column: "thumbnail_path"},
+	ArtifactVideo:     {prefix: "videos", extension: "mp4", column: "video_file_path"},
+}
+
+// ArtifactColumn returns the articles column holding the storage key of the
+// current artifact of a kind
+func ArtifactColumn(kind string) (string, bool) {
+	k, ok := artifactKinds[kind]
+	return k.column, ok
+}
+
+// ArtifactPrefixes returns the storage key prefixes media is stored under,
+// including the staging prefix of uploads that have not finished
+func ArtifactPrefixes() []string {
+	prefixes := []string{uploadPrefix + "/"}
+	for _, kind := range []string{ArtifactAudio, ArtifactThumbnail, ArtifactVideo} {
+		prefixes = append(prefixes, artifactKinds[kind].prefix+"/")
+	}
+	return prefixes
+}
+
+// StoredFile is a file saved under a content-addressed key
+type StoredFile struct {
+	Kind        string
+	Key         string
+	Checksum    string // hex SHA-256 of the content
+	Size        int64
+	ContentType string
+}
+
+// ArtifactStore saves generated media under keys derived from a hash of the
+// content, and records each rendition so an article can keep several and
+// switch between them. A new rendition never overwrites an old one, so
+// caches can't serve stale media under a reused key.
+type ArtifactStore struct {
+	db      *sql.DB
+	storage Storage
+}
+
+func NewArtifactStore(db *sql.DB, storage Storage) *ArtifactStore {
+	return &ArtifactStore{
+		db:      db,
+		storage: storage,
+	}
+}
+
+// Put streams body to storage and returns where it was saved. The content is
+// hashed while it is uploaded to a staging key under uploads/, then moved to
+// its content-addressed key; identical content is stored once.
+func (s *ArtifactStore) Put(ctx context.Context, kind string, body io.Reader, contentType string) (*StoredFile, error) {
+	k, ok := artifactKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown artifact kind %q", kind)
+	}
+
+	stagingKey, err := generateUploadKey(k)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(body, hash)}
+	if err := s.storage.Upload(ctx, stagingKey, counter, contentType); err != nil {
+		return nil, err
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	key := GenerateArtifactKey(kind, checksum)
+
+	// Keep the copy that is already there, it has the same content
+	if _, err := s.storage.Stat(ctx, key); err == nil {
+		if err := s.storage.Delete(ctx, stagingKey); err != nil {
+			return nil, err
+		}
+	} else if errors.Is(err, ErrFileNotFound) {
+		if err := s.storage.Move(ctx, stagingKey, key); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+
+	return &StoredFile{
+		Kind:        kind,
+		Key:         key,
+		Checksum:    checksum,
+		Size:        counter.n,
+		ContentType: contentType,
+	}, nil
+}
+
+// Record saves a stored file as a rendition of an article and makes it the
+// current one of its kind. durationSeconds is 0 when it does not apply, and
+// params are the settings the file was generated with. Recording the same
+// content twice reuses the existing artifact.
+func (s *ArtifactStore) Record(ctx context.Context, articleID int64, file *StoredFile, durationSeconds float64, params map[string]interface{}) (int64, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal artifact params: %w", err)
+	}
+
+	duration := sql.NullFloat64{Float64: durationSeconds, Valid: durationSeconds > 0}
+
+	var artifactID int64
+	query := `INSERT INTO artifacts (article_id, kind, storage_key, checksum, size_bytes, mime_type, duration_seconds, params)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	          ON CONFLICT (article_id, kind, checksum)
+	          DO UPDATE SET duration_seconds = EXCLUDED.duration_seconds, params = EXCLUDED.params
+	          RETURNING id`
+	err = s.db.QueryRowContext(ctx, query, articleID, file.Kind, file.Key, file.Checksum, file.Size,
+		file.ContentType, duration, string(paramsJSON)).Scan(&artifactID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save artifact: %w", err)
+	}
+
+	if err := s.SetCurrent(ctx, articleID, artifactID); err != nil {
+		return 0, err
+	}
+	return artifactID, nil
+}
+
+// SetCurrent makes an artifact the active rendition of its kind, and points
+// the article's media column at its key
+func (s *ArtifactStore) SetCurrent(ctx context.Context, articleID, artifactID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var kind, key string
+	err = tx.QueryRowContext(ctx, `SELECT kind, storage_key FROM artifacts WHERE id = $1 AND article_id = $2`,
+		artifactID, articleID).Scan(&kind, &key)
+	if err == sql.ErrNoRows {
+		return ErrArtifactNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch artifact: %w", err)
+	}
+
+	column, ok := ArtifactColumn(kind)
+	if !ok {
+		return fmt.Errorf("unknown artifact kind %q", kind)
+	}
+
+	// Clear the old pointer first, only one artifact of a kind may be current
+	_, err = tx.ExecContext(ctx, `UPDATE artifacts SET is_current = FALSE
+	                              WHERE article_id = $1 AND kind = $2 AND is_current AND id <> $3`,
+		articleID, kind, artifactID)
+	if err != nil {
+		return fmt.Errorf("failed to clear current artifact: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE artifacts SET is_current = TRUE WHERE id = $1`, artifactID); err != nil {
+		return fmt.Errorf("failed to set current artifact: %w", err)
+	}
+
+	query := fmt.Sprintf(`UPDATE articles SET %s = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, column)
+	if _, err := tx.ExecContext(ctx, query, key, articleID); err != nil {
+		return fmt.Errorf("failed to update article media: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GenerateArtifactKey generates the content-addressed storage key of a file
+// ("audio/<sha256>.mp3")
+func GenerateArtifactKey(kind, checksum string) string {
+	k := artifactKinds[kind]
+	return path.Join(k.prefix, fmt.Sprintf("%s.%s", checksum, k.extension))
+}
+
+// generateUploadKey generates a random staging key for a file being uploaded
+// ("uploads/videos/<random>.mp4"). Staged files left behind by an interrupted
+// upload are never referenced by an article.
+func generateUploadKey(k artifactKind) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload key: %w", err)
+	}
+	return path.Join(uploadPrefix, k.prefix, fmt.Sprintf("%s.%s", hex.EncodeToString(b), k.extension)), nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
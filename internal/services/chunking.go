@@ -0,0 +1,173 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Section is a contiguous part of a document, optionally under a heading.
+// Start and End are the byte offsets of the section within the original
+// document; Text holds its paragraphs separated by blank lines.
+type Section struct {
+	Heading string
+	Text    string
+	Start   int
+	End     int
+}
+
+// EstimateTokens approximates the number of model tokens in text. Gemini
+// averages about four characters per token for English prose, which is close
+// enough to decide when a document needs to be split.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// ChunkContent splits content into sections of at most maxTokens each. New
+// sections start at headings where possible, paragraphs are never split
+// unless a single paragraph is larger than maxTokens, and section order
+// follows the document.
+func ChunkContent(content string, maxTokens int) []Section {
+	if maxTokens <= 0 {
+		maxTokens = 1
+	}
+
+	var sections []Section
+	var current *Section
+	heading := ""
+
+	flush := func() {
+		if current != nil && strings.TrimSpace(current.Text) != "" {
+			current.Text = strings.TrimSpace(current.Text)
+			sections = append(sections, *current)
+		}
+		current = nil
+	}
+
+	for _, block := range splitBlocks(content) {
+		text := content[block.start:block.end]
+
+		if isHeading(text) {
+			// Start a new section at each heading, unless the current one is
+			// still too small to be worth summarizing on its own
+			if current != nil && EstimateTokens(current.Text) >= maxTokens/8 {
+				flush()
+			}
+			heading = strings.TrimSpace(strings.TrimLeft(text, "# "))
+		}
+
+		for _, piece := range splitOversized(text, block.start, maxTokens) {
+			if current != nil && EstimateTokens(current.Text)+EstimateTokens(piece.text) > maxTokens {
+				flush()
+			}
+			if current == nil {
+				current = &Section{Heading: heading, Start: piece.start}
+			} else {
+				current.Text += "\n\n"
+			}
+			current.Text += piece.text
+			current.End = piece.start + len(piece.text)
+		}
+	}
+	flush()
+
+	return sections
+}
+
+type block struct {
+	start int
+	end   int
+}
+
+// splitBlocks returns the byte ranges of the non-empty lines of content
+func splitBlocks(content string) []block {
+	var blocks []block
+	start := 0
+	for start < len(content) {
+		end := strings.IndexByte(content[start:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += start
+		}
+
+		line := content[start:end]
+		trimmedStart := start + (len(line) - len(strings.TrimLeftFunc(line, unicode.IsSpace)))
+		trimmedEnd := start + len(strings.TrimRightFunc(line, unicode.IsSpace))
+		if trimmedEnd > trimmedStart {
+			blocks = append(blocks, block{start: trimmedStart, end: trimmedEnd})
+		}
+
+		start = end + 1
+	}
+	return blocks
+}
+
+// isHeading guesses whether a line is a heading: a Markdown heading, or a
+// short line that does not end like a sentence
+func isHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return true
+	}
+	if strings.HasPrefix(line, "-") || strings.HasPrefix(line, "*") || strings.HasPrefix(line, "•") {
+		return false
+	}
+	if line == "" || utf8.RuneCountInString(line) > 80 || len(strings.Fields(line)) > 12 {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(line)
+	return !strings.ContainsRune(".!?:;,\"')]»…", last)
+}
+
+type piece struct {
+	text  string
+	start int
+}
+
+// splitOversized breaks a paragraph larger than maxTokens at sentence
+// boundaries, falling back to word boundaries for very long sentences
+func splitOversized(text string, offset int, maxTokens int) []piece {
+	if EstimateTokens(text) <= maxTokens {
+		return []piece{{text: text, start: offset}}
+	}
+
+	maxBytes := maxTokens * 4
+	var pieces []piece
+	for len(text) > 0 {
+		if EstimateTokens(text) <= maxTokens {
+			pieces = append(pieces, piece{text: text, start: offset})
+			break
+		}
+
+		cut := len(text)
+		if cut > maxBytes {
+			cut = maxBytes
+		}
+		window := text[:cut]
+		if i := strings.LastIndexAny(window, ".!?"); i > maxBytes/2 {
+			cut = i + 1
+		} else if i := strings.LastIndexFunc(window, unicode.IsSpace); i > 0 {
+			cut = i
+		}
+		// Never cut in the middle of a UTF-8 sequence
+		for cut > 0 && cut < len(text) && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			cut = len(window)
+			for cut < len(text) && !utf8.RuneStart(text[cut]) {
+				cut++
+			}
+		}
+
+		chunk := strings.TrimRightFunc(text[:cut], unicode.IsSpace)
+		if chunk != "" {
+			pieces = append(pieces, piece{text: chunk, start: offset})
+		}
+		rest := strings.TrimLeftFunc(text[cut:], unicode.IsSpace)
+		offset += len(text) - len(rest)
+		text = rest
+	}
+	return pieces
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func TestChunkContent(t *testing.T) {
+	sentences := make([]string, 0, 30)
+	for i := 0; i < 30; i++ {
+		sentences = append(sentences, "Rivers carry sediment downstream and drop it where the current slows.")
+	}
+	longParagraph := strings.Join(sentences, " ")
+
+	tests := []struct {
+		name      string
+		content   string
+		maxTokens int
+		sections  int      // expected number of sections; -1 when only the invariants are checked
+		headings  []string // expected heading of each section, when given
+		sentences bool     // every section must end at a sentence boundary
+	}{
+		{
+			name:      "empty",
+			content:   "",
+			maxTokens: 100,
+			sections:  0,
+		},
+		{
+			name:      "only whitespace",
+			content:   " \n\n\t\n ",
+			maxTokens: 100,
+			sections:  0,
+		},
+		{
+			name:      "fits in one section",
+			content:   "A short article.\n\nWith two paragraphs.",
+			maxTokens: 100,
+			sections:  1,
+		},
+		{
+			name:      "paragraph longer than the chunk size",
+			content:   longParagraph,
+			maxTokens: 60,
+			sections:  -1,
+			sentences: true,
+		},
+		{
+			name:      "multibyte text without spaces",
+			content:   strings.Repeat("日本語の文章", 40),
+			maxTokens: 10,
+			sections:  -1,
+		},
+		{
+			name:      "multibyte words at a chunk boundary",
+			content:   strings.Repeat("Ça coûte très cher à Zürich ", 20),
+			maxTokens: 15,
+			sections:  -1,
+		},
+		{
+			name: "markdown headings",
+			content: "# Introduction\n\n" + strings.Repeat("The opening paragraph sets the scene. ", 5) +
+				"\n\n## Details\n\n" + strings.Repeat("The second part goes deeper. ", 5),
+			maxTokens: 100,
+			sections:  2,
+			headings:  []string{"Introduction", "Details"},
+		},
+		{
+			name: "plain text headings",
+			content: "Background\n\n" + strings.Repeat("Meanders form over centuries. ", 5) +
+				"\n\nWhat Comes Next\n\n" + strings.Repeat("Oxbow lakes are left behind. ", 5),
+			maxTokens: 100,
+			sections:  2,
+			headings:  []string{"Background", "What Comes Next"},
+		},
+		{
+			name:      "heading before a tiny section is merged",
+			content:   "# One\n\nShort.\n\n# Two\n\n" + strings.Repeat("The rest of the article. ", 5),
+			maxTokens: 400,
+			sections:  1,
+			headings:  []string{"One"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sections := ChunkContent(tt.content, tt.maxTokens)
+
+			if tt.sections >= 0 && len(sections) != tt.sections {
+				t.Fatalf("got %d sections, want %d: %+v", len(sections), tt.sections, sections)
+			}
+			if tt.sections < 0 && len(sections) < 2 {
+				t.Fatalf("got %d sections, want the content split", len(sections))
+			}
+			for i, heading := range tt.headings {
+				if sections[i].Heading != heading {
+					t.Errorf("section %d heading = %q, want %q", i, sections[i].Heading, heading)
+				}
+			}
+
+			for i, section := range sections {
+				if tt.sentences && !strings.HasSuffix(section.Text, ".") {
+					t.Errorf("section %d does not end at a sentence boundary: %q", i, section.Text)
+				}
+			}
+
+			checkSections(t, tt.content, sections, tt.maxTokens)
+		})
+	}
+}
+
+// checkSections verifies what every chunking must guarantee: sections are
+// valid UTF-8, fit maxTokens, follow the document order and together hold all
+// of its text
+func checkSections(t *testing.T, content string, sections []Section, maxTokens int) {
+	t.Helper()
+
+	var all strings.Builder
+	end := 0
+	for i, section := range sections {
+		if !utf8.ValidString(section.Text) {
+			t.Errorf("section %d is not valid UTF-8: %q", i, section.Text)
+		}
+		if tokens := EstimateTokens(section.Text); tokens > maxTokens {
+			t.Errorf("section %d has %d tokens, more than %d", i, tokens, maxTokens)
+		}
+		if section.Start < end || section.End < section.Start || section.End > len(content) {
+			t.Errorf("section %d spans %d-%d after a section ending at %d, in %d bytes", i, section.Start, section.End, end, len(content))
+			continue
+		}
+		if !utf8.ValidString(content[section.Start:section.End]) {
+			t.Errorf("section %d offsets %d-%d split a UTF-8 sequence", i, section.Start, section.End)
+		}
+		end = section.End
+		all.WriteString(section.Text)
+	}
+
+	if got, want := withoutSpace(all.String()), withoutSpace(content); got != want {
+		t.Errorf("sections hold %q, want %q", got, want)
+	}
+}
+
+func withoutSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func TestIsHeading(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"# Title", true},
+		{"### A deeper heading.", true},
+		{"Why Rivers Meander", true},
+		{"Rivers rarely run straight.", false},
+		{"- a list item", false},
+		{"• a bullet", false},
+		{"Note:", false},
+		{strings.Repeat("word ", 20), false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isHeading(tt.line); got != tt.want {
+			t.Errorf("isHeading(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ChatAnswer is a chat reply with the article passages that back it
+type ChatAnswer struct {
+	Content   string     `json:"content"`
+	Citations []Citation `json:"citations"`
+	// OutsideArticle is set when part of the answer is not supported by the article
+	OutsideArticle bool `json:"outside_article"`
+}
+
+// Citation points a claim in the answer at a paragraph of the article. Start
+// and End are character offsets of the paragraph in the original content;
+// AnswerOffset is the character offset in the answer where the claim ends.
+type Citation struct {
+	Paragraph    int `json:"paragraph"`
+	Start        int `json:"start"`
+	End          int `json:"end"`
+	AnswerOffset int `json:"answer_offset"`
+}
+
+// outsideArticleMarker is how the model flags answers that go beyond the article
+const outsideArticleMarker = "[OUTSIDE]"
+
+// citationMarker matches paragraph markers such as [P3] or [P3, P7]
+var citationMarker = regexp.MustCompile(`\[P\d+(?:\s*,\s*P?\d+)*\]`)
+
+// paragraphSpan is the location of a paragraph in the article, in characters
+type paragraphSpan struct {
+	start int
+	end   int
+}
+
+// articleParagraphs splits content into its non-empty lines, which are the
+// paragraphs citations refer to
+func articleParagraphs(content string) ([]paragraphSpan, []string) {
+	var spans []paragraphSpan
+	var texts []string
+
+	runeOffset, byteOffset := 0, 0
+	for _, b := range splitBlocks(content) {
+		runeOffset += utf8.RuneCountInString(content[byteOffset:b.start])
+		length := utf8.RuneCountInString(content[b.start:b.end])
+		spans = append(spans, paragraphSpan{start: runeOffset, end: runeOffset + length})
+		texts = append(texts, content[b.start:b.end])
+		runeOffset += length
+		byteOffset = b.end
+	}
+	return spans, texts
+}
+
+// numberedArticle prefixes each paragraph of the article with its marker
+func numberedArticle(content string) string {
+	_, texts := articleParagraphs(content)
+
+	var b strings.Builder
+	for i, text := range texts {
+		fmt.Fprintf(&b, "[P%d] %s\n\n", i+1, text)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// parseChatAnswer strips the citation and outside-article markers from a reply
+// and resolves the citations to locations in the article
+func parseChatAnswer(reply string, articleContent string) *ChatAnswer {
+	content, refs, outside := stripCitationMarkers(reply, citationMarker, "P")
+	answer := &ChatAnswer{Content: content, Citations: []Citation{}, OutsideArticle: outside}
+
+	spans, _ := articleParagraphs(articleContent)
+	for _, ref := range refs {
+		if ref.number < 1 || ref.number > len(spans) {
+			continue
+		}
+		citation := Citation{
+			Paragraph:    ref.number - 1,
+			Start:        spans[ref.number-1].start,
+			End:          spans[ref.number-1].end,
+			AnswerOffset: ref.answerOffset,
+		}
+		if !containsCitation(answer.Citations, citation) {
+			answer.Citations = append(answer.Citations, citation)
+		}
+	}
+	return answer
+}
+
+// markerRef is a numbered source marker found in a reply
+type markerRef struct {
+	number       int
+	answerOffset int // character offset in the cleaned reply
+}
+
+// stripCitationMarkers removes source markers such as [P3] or [S1, S4] and the
+// outside marker from a reply. It returns the cleaned reply, the numbers of
+// the cited sources with where they were cited, and whether the outside
+// marker was present.
+func stripCitationMarkers(reply string, marker *regexp.Regexp, prefix string) (string, []markerRef, bool) {
+	outside := strings.Contains(reply, outsideArticleMarker)
+	reply = strings.ReplaceAll(reply, outsideArticleMarker, "")
+
+	var refs []markerRef
+	var b strings.Builder
+	last := 0
+	for _, loc := range marker.FindAllStringIndex(reply, -1) {
+		// Drop the space the model usually leaves before a marker
+		b.WriteString(strings.TrimRight(reply[last:loc[0]], " "))
+		last = loc[1]
+
+		answerOffset := utf8.RuneCountInString(b.String())
+		for _, number := range strings.Split(strings.Trim(reply[loc[0]:loc[1]], "[]"), ",") {
+			n, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(number), prefix))
+			if err != nil {
+				continue
+			}
+			refs = append(refs, markerRef{number: n, answerOffset: answerOffset})
+		}
+	}
+	b.WriteString(reply[last:])
+
+	return strings.TrimSpace(b.String()), refs, outside
+}
+
+func containsCitation(citations []Citation, citation Citation) bool {
+	for _, c := range citations {
+		if c == citation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+type VideoComposer struct {
+	ffmpegPath  string
+	ffprobePath string
+}
+
+// ComposeScene is one generated clip and the narration that plays over it
+type ComposeScene struct {
+	VideoPath       string
+	NarrationPath   string
+	DurationSeconds int
+}
+
+func NewVideoComposer() *VideoComposer {
+	ffmpegPath := os.Getenv("FFMPEG_PATH")
+	if ffmpegPath == "" {
+		ffmpegPath = "ffmpeg"
+	}
+	ffprobePath := os.Getenv("FFPROBE_PATH")
+	if ffprobePath == "" {
+		ffprobePath = "ffprobe"
+	}
+
+	return &VideoComposer{
+		ffmpegPath:  ffmpegPath,
+		ffprobePath: ffprobePath,
+	}
+}
+
+// Compose stitches the scenes in order into a single MP4, replacing each clip's
+// audio with its narration and letterboxing it to width x height. When a
+// narration runs longer than its clip, the last frame of the clip is held
+// until the narration finishes. The MP4 is fragmented so it can be streamed
+// to output as it is encoded, without a temporary file. Returns the duration
+// of the video in seconds.
+func (c *VideoComposer) Compose(ctx context.Context, scenes []ComposeScene, width, height int, output io.Writer) (float64, error) {
+	if len(scenes) == 0 {
+		return 0, fmt.Errorf("no scenes to compose")
+	}
+
+	args := []string{"-y"}
+	for _, scene := range scenes {
+		args = append(args, "-i", scene.VideoPath)
+	}
+	for _, scene := range scenes {
+		args = append(args, "-i", scene.NarrationPath)
+	}
+
+	var filter strings.Builder
+	var concatInputs strings.Builder
+	var totalDuration float64
+	for i, scene := range scenes {
+		narrationDuration, err := c.probeDuration(ctx, scene.NarrationPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to probe narration for scene %d: %w", i, err)
+		}
+
+		sceneDuration := float64(scene.DurationSeconds)
+		hold := 0.0
+		if narrationDuration > sceneDuration {
+			hold = narrationDuration - sceneDuration
+			sceneDuration = narrationDuration
+		}
+		totalDuration += sceneDuration
+
+		fmt.Fprintf(&filter,
+			"[%d:v]trim=duration=%d,setpts=PTS-STARTPTS,tpad=stop_mode=clone:stop_duration=%.3f,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30[v%d];",
+			i, scene.DurationSeconds, hold, width, height, width, height, i)
+		fmt.Fprintf(&filter,
+			"[%d:a]aresample=44100,aformat=channel_layouts=stereo,apad,atrim=duration=%.3f,asetpts=PTS-STARTPTS[a%d];",
+			len(scenes)+i, sceneDuration, i)
+		fmt.Fprintf(&concatInputs, "[v%d][a%d]", i, i)
+	}
+	fmt.Fprintf(&filter, "%sconcat=n=%d:v=1:a=1[v][a]", concatInputs.String(), len(scenes))
+
+	args = append(args,
+		"-filter_complex", filter.String(),
+		"-map", "[v]",
+		"-map", "[a]",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "23",
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4",
+		"pipe:1",
+	)
+
+	cmd := exec.CommandContext(ctx, c.ffmpegPath, args...)
+	cmd.Stdout = output
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("ffmpeg failed: %w - %s", err, lastLines(stderr.String(), 10))
+	}
+
+	return totalDuration, nil
+}
+
+// VideoDimensions returns the frame size for an aspect ratio at a resolution,
+// where the resolution names the short side ("720p" with "9:16" is 720x1280)
+func VideoDimensions(aspectRatio, resolution string) (int, int) {
+	short, err := strconv.Atoi(strings.TrimSuffix(resolution, "p"))
+	if err != nil || short <= 0 {
+		short = 720
+	}
+
+	w, h := 16, 9
+	if parts := strings.SplitN(aspectRatio, ":", 2); len(parts) == 2 {
+		pw, errW := strconv.Atoi(parts[0])
+		ph, errH := strconv.Atoi(parts[1])
+		if errW == nil && errH == nil && pw > 0 && ph > 0 {
+			w, h = pw, ph
+		}
+	}
+
+	// Keep both sides even, as required by libx264
+	if w >= h {
+		return (short*w/h + 1) &^ 1, short
+	}
+	return short, (short*h/w + 1) &^ 1
+}
+
+// probeDuration returns the duration of a media file in seconds
+func (c *VideoComposer) probeDuration(ctx context.Context, path string) (float64, error) {
+	cmd := exec.CommandContext(ctx, c.ffprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration %q: %w", strings.TrimSpace(string(output)), err)
+	}
+
+	return duration, nil
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -10,16 +10,16 @@ import (
 )
 
 type ElevenLabsService struct {
-	apiKey         string
-	storageService *StorageService
-	client         *http.Client
+	apiKey    string
+	artifacts *ArtifactStore
+	client    *http.Client
 }
 
-func NewElevenLabsService(apiKey string, storageService *StorageService) *ElevenLabsService {
+func NewElevenLabsService(apiKey string, artifacts *ArtifactStore) *ElevenLabsService {
 	return &ElevenLabsService{
-		apiKey:         apiKey,
-		storageService: storageService,
-		client:         &http.Client{},
+		apiKey:    apiKey,
+		artifacts: artifacts,
+		client:    &http.Client{},
 	}
 }
 
@@ -35,9 +35,27 @@ type voiceSettings struct {
 	SimilarityBoost float64 `json:"similarity_boost"`
 }
 
-// ConvertTextToSpeech converts text to speech and uploads it to Supabase storage
-// Returns the public URL where audio is stored
-func (e *ElevenLabsService) ConvertTextToSpeech(text string, articleID int64, language, style string) (string, error) {
+// ConvertTextToSpeech converts text to speech and streams it to storage
+// Returns where the audio was stored
+func (e *ElevenLabsService) ConvertTextToSpeech(text string, language, style string) (*StoredFile, error) {
+	audio, err := e.SynthesizeSpeech(text, language)
+	if err != nil {
+		return nil, err
+	}
+	defer audio.Close()
+
+	// Upload to storage under a key derived from the content
+	file, err := e.artifacts.Put(context.Background(), ArtifactAudio, audio, "audio/mpeg")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload audio to storage: %w", err)
+	}
+
+	return file, nil
+}
+
+// SynthesizeSpeech converts text to speech and returns the MP3 stream. The
+// caller must close it.
+func (e *ElevenLabsService) SynthesizeSpeech(text string, language string) (io.ReadCloser, error) {
 	// Use default voice ID (Rachel - a versatile voice)
 	// You can change this to other voice IDs from ElevenLabs
 	voiceID := "21m00Tcm4TlvDq8ikWAM"
@@ -65,13 +83,13 @@ func (e *ElevenLabsService) ConvertTextToSpeech(text string, articleID int64, la
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	apiURL := fmt.Sprintf("https://api.elevenlabs.io/v1/text-to-speech/%s", voiceID)
 	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Accept", "audio/mpeg")
@@ -80,29 +98,14 @@ func (e *ElevenLabsService) ConvertTextToSpeech(text string, articleID int64, la
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call API: %w", err)
+		return nil, fmt.Errorf("failed to call API: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("elevenlabs API error: %s - %s", resp.Status, string(body))
-	}
-
-	// Read audio data
-	audioData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read audio data: %w", err)
-	}
-
-	// Generate storage key
-	key := GenerateAudioKey(articleID)
-
-	// Upload to Supabase storage
-	publicURL, err := e.storageService.UploadFile(context.Background(), key, audioData, "audio/mpeg")
-	if err != nil {
-		return "", fmt.Errorf("failed to upload audio to storage: %w", err)
+		return nil, fmt.Errorf("elevenlabs API error: %s - %s", resp.Status, string(body))
 	}
 
-	return publicURL, nil
+	return resp.Body, nil
 }
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailConfig configures sending notifications by SMTP
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string // no authentication when empty
+	Password string
+	From     string // e.g. "PocketScribe <notifications@example.com>"
+
+	// WebAppURL is where the web app is served; emails link to
+	// WebAppURL/articles/42. They link the original article when it is empty.
+	WebAppURL string
+}
+
+// EmailService sends notifications as plain text email
+type EmailService struct {
+	addr      string
+	auth      smtp.Auth
+	from      *mail.Address
+	webAppURL string
+}
+
+// NewEmailService creates an email service for an SMTP server. STARTTLS is
+// used when the server offers it.
+func NewEmailService(cfg EmailConfig) (*EmailService, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP from address: %w", err)
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return &EmailService{
+		addr:      net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		auth:      auth,
+		from:      from,
+		webAppURL: strings.TrimSuffix(cfg.WebAppURL, "/"),
+	}, nil
+}
+
+// Channel returns ChannelEmail
+func (s *EmailService) Channel() string {
+	return ChannelEmail
+}
+
+// Notify emails a notification, listing the article links it is about
+func (s *EmailService) Notify(ctx context.Context, recipient Recipient, notification Notification) error {
+	to, err := mail.ParseAddress(recipient.Address)
+	if err != nil {
+		// The address comes from the account; there is no device to remove
+		return fmt.Errorf("invalid email address %q: %w", recipient.Address, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	message := s.message(to, notification)
+	if err := smtp.SendMail(s.addr, s.auth, s.from.Address, []string{to.Address}, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("Email: Successfully sent %s notification to %s", notification.Event, to.Address)
+	return nil
+}
+
+// message builds a plain text UTF-8 email
+func (s *EmailService) message(to *mail.Address, notification Notification) []byte {
+	var body strings.Builder
+	body.WriteString(notification.Body + "\r\n")
+	if notification.Subtitle != "" {
+		body.WriteString("\r\n" + notification.Subtitle + "\r\n")
+	}
+
+	articles := notification.Articles
+	if notification.Article != nil {
+		articles = []ArticleNotification{*notification.Article}
+	}
+	if len(articles) > 0 {
+		body.WriteString("\r\n")
+	}
+	for _, article := range articles {
+		title := article.Title
+		if title == "" {
+			title = article.URL
+		}
+		body.WriteString(fmt.Sprintf("- %s\r\n  %s\r\n", title, s.articleLink(article)))
+	}
+
+	subject := notification.Title
+	if notification.Subtitle != "" && notification.Event == EventArticleFailed {
+		subject = fmt.Sprintf("%s: %s", notification.Title, notification.Subtitle)
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&message, "To: %s\r\n", to.String())
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(body.String())
+	return message.Bytes()
+}
+
+// articleLink links the article in the web app, or the original article
+func (s *EmailService) articleLink(article ArticleNotification) string {
+	if s.webAppURL != "" {
+		return fmt.Sprintf("%s/articles/%d", s.webAppURL, article.ArticleID)
+	}
+	return article.URL
+}
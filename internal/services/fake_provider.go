@@ -0,0 +1,205 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"sort"
+	"strings"
+)
+
+// FakeLLMProvider is a deterministic LLMProvider that never touches the network.
+// The same input always produces the same output, which makes it suitable for
+// tests and local development without API keys.
+type FakeLLMProvider struct{}
+
+func NewFakeLLMProvider() *FakeLLMProvider {
+	return &FakeLLMProvider{}
+}
+
+// Generate echoes a fingerprint of the prompt, or a value shaped like the
+// requested JSON schema
+func (f *FakeLLMProvider) Generate(ctx context.Context, model string, prompt string, opts GenerateOptions) (string, error) {
+	if opts.Schema != nil {
+		data, err := json.Marshal(fakeValue(opts.Schema, fingerprint(prompt)))
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	text := fmt.Sprintf("Fake %s response %s: %s", model, fingerprint(prompt), firstWords(longestParagraph(prompt), 30))
+	if opts.JSON {
+		// Without a schema there is no shape to follow; callers that parse
+		// JSON pass their schema, as the storyboard and tags do
+		data, err := json.Marshal(map[string]string{"text": text})
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	return text, nil
+}
+
+// Chat replies by quoting the last user message
+func (f *FakeLLMProvider) Chat(ctx context.Context, model string, system string, history []ChatMessage, opts GenerateOptions) (string, error) {
+	last := ""
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			last = history[i].Content
+			break
+		}
+	}
+
+	if opts.Schema != nil || opts.JSON {
+		return f.Generate(ctx, model, system+"\n"+last, opts)
+	}
+
+	return fmt.Sprintf("Fake %s reply %s to: %s", model, fingerprint(system+"\n"+last), last), nil
+}
+
+// ChatStream streams the Chat reply one word at a time
+func (f *FakeLLMProvider) ChatStream(ctx context.Context, model string, system string, history []ChatMessage, opts GenerateOptions, onChunk func(string) error) (string, error) {
+	reply, err := f.Chat(ctx, model, system, history, opts)
+	if err != nil {
+		return "", err
+	}
+
+	words := strings.SplitAfter(reply, " ")
+	for _, word := range words {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if err := onChunk(word); err != nil {
+			return "", err
+		}
+	}
+	return reply, nil
+}
+
+// GenerateImage returns a small solid-color PNG whose color depends on the prompt
+func (f *FakeLLMProvider) GenerateImage(ctx context.Context, model string, prompt string, opts ImageOptions) ([]byte, error) {
+	width, height := 64, 36
+	switch opts.AspectRatio {
+	case "9:16":
+		width, height = 36, 64
+	case "1:1":
+		width, height = 64, 64
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(prompt))
+	sum := h.Sum32()
+	fill := color.RGBA{R: uint8(sum >> 16), G: uint8(sum >> 8), B: uint8(sum), A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Embed hashes each word of a text into a bucket of the vector, so texts that
+// share words are close to each other
+func (f *FakeLLMProvider) Embed(ctx context.Context, model string, texts []string, opts EmbedOptions) ([][]float32, error) {
+	dimensions := opts.Dimensions
+	if dimensions <= 0 {
+		dimensions = 768
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, dimensions)
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			word = strings.Trim(word, ".,;:!?\"'()[]")
+			if word == "" {
+				continue
+			}
+			h := fnv.New32a()
+			h.Write([]byte(word))
+			vector[h.Sum32()%uint32(dimensions)]++
+		}
+		vectors[i] = normalizeVector(vector)
+	}
+	return vectors, nil
+}
+
+// fakeValue builds a value that satisfies a (simple) JSON schema
+func fakeValue(schema map[string]interface{}, seed string) interface{} {
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	schemaType, _ := schema["type"].(string)
+	switch schemaType {
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(properties))
+		for name := range properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		object := make(map[string]interface{}, len(properties))
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				object[name] = fakeValue(property, seed+"."+name)
+			}
+		}
+		return object
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if items == nil {
+			return []interface{}{}
+		}
+		return []interface{}{fakeValue(items, seed+"[0]")}
+	case "integer", "number":
+		if minimum, ok := schema["minimum"].(float64); ok {
+			return minimum
+		}
+		return 0
+	case "boolean":
+		return false
+	default:
+		return "fake " + seed
+	}
+}
+
+// fingerprint returns a short stable identifier for a string
+func fingerprint(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// longestParagraph returns the longest blank-line separated block, which in
+// most prompts is the content being worked on rather than the instructions
+func longestParagraph(s string) string {
+	longest := ""
+	for _, paragraph := range strings.Split(s, "\n\n") {
+		if len(paragraph) > len(longest) {
+			longest = paragraph
+		}
+	}
+	return strings.TrimSpace(longest)
+}
+
+func firstWords(s string, n int) string {
+	words := strings.Fields(s)
+	if len(words) > n {
+		words = words[:n]
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const fakeArticleHTML = `<html><body>
+<nav><a href="/">Home</a></nav>
+<h1>Why Rivers Meander</h1>
+<p>Rivers rarely run straight. Small bends grow as water erodes the outer bank and deposits sediment on the inner bank.</p>
+<p>Over centuries the bends become loops, and some loops are cut off to form oxbow lakes.</p>
+</body></html>`
+
+func newFakeGeminiService() *GeminiService {
+	return NewGeminiService(NewFakeLLMProvider(), LLMModels{
+		Summarize: "fake-summarize",
+		Title:     "fake-title",
+		Chat:      "fake-chat",
+	}, SummarizeOptions{})
+}
+
+func TestFakeProviderSummarizeAndStoryboard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(fakeArticleHTML))
+	}))
+	defer server.Close()
+
+	gemini := newFakeGeminiService()
+
+	summary, err := gemini.SummarizeArticle(server.URL, "s", "", "")
+	if err != nil {
+		t.Fatalf("SummarizeArticle: %v", err)
+	}
+	if summary.Content == "" || summary.Speech == "" || summary.Display == "" {
+		t.Fatalf("summary has empty parts: %+v", summary)
+	}
+
+	again, err := gemini.SummarizeArticle(server.URL, "s", "", "")
+	if err != nil {
+		t.Fatalf("SummarizeArticle: %v", err)
+	}
+	if *again != *summary {
+		t.Error("the fake provider summarized the same article differently")
+	}
+
+	storyboard, err := gemini.GenerateStoryboard(summary.Speech, 30, "", "16:9")
+	if err != nil {
+		t.Fatalf("GenerateStoryboard: %v", err)
+	}
+	if storyboard.VisualStyle == "" {
+		t.Error("storyboard has no visual style")
+	}
+	for i, scene := range storyboard.Scenes {
+		if scene.VisualPrompt == "" || scene.Narration == "" {
+			t.Errorf("scene %d is empty: %+v", i, scene)
+		}
+		if NearestSupportedDuration(scene.DurationSeconds) != scene.DurationSeconds {
+			t.Errorf("scene %d lasts %d seconds, which the video model does not accept", i, scene.DurationSeconds)
+		}
+	}
+}
+
+func TestFakeProviderJSONWithoutSchema(t *testing.T) {
+	text, err := NewFakeLLMProvider().Generate(t.Context(), "fake", "Describe the article", GenerateOptions{JSON: true})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !strings.HasPrefix(text, "{") || text == "{}" {
+		t.Errorf("Generate returned %q, want a JSON object with content", text)
+	}
+}
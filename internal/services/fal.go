@@ -2,32 +2,132 @@ package services
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 )
 
 type FalService struct {
 	apiKey     string
+	model      VideoModel
 	httpClient *http.Client
 }
 
+// VideoModel describes a Fal video model and the output options it supports
+type VideoModel struct {
+	ID           string   // model path used to submit requests
+	QueueApp     string   // app path used for request status
+	AspectRatios []string // supported aspect ratios, the first is the default
+	Resolutions  []string // supported resolutions, the first is the default
+}
+
+// VideoModels lists the Fal video models that can be selected with FAL_VIDEO_MODEL
+var VideoModels = map[string]VideoModel{
+	"fal-ai/sora-2": {
+		ID:           "fal-ai/sora-2",
+		QueueApp:     "fal-ai/sora-2",
+		AspectRatios: []string{"16:9", "9:16"},
+		Resolutions:  []string{"720p"},
+	},
+	"fal-ai/sora-2/text-to-video/pro": {
+		ID:           "fal-ai/sora-2/text-to-video/pro",
+		QueueApp:     "fal-ai/sora-2",
+		AspectRatios: []string{"16:9", "9:16"},
+		Resolutions:  []string{"720p", "1080p"},
+	},
+}
+
+// DefaultVideoModel is used when FAL_VIDEO_MODEL is unset or unknown
+const DefaultVideoModel = "fal-ai/sora-2"
+
 func NewFalService() *FalService {
+	model, ok := VideoModels[os.Getenv("FAL_VIDEO_MODEL")]
+	if !ok {
+		model = VideoModels[DefaultVideoModel]
+	}
+
 	return &FalService{
 		apiKey: os.Getenv("FAL_API_KEY"),
+		model:  model,
 		httpClient: &http.Client{
 			Timeout: 5 * time.Minute, // Video generation can take time
 		},
 	}
 }
 
+// Model returns the video model requests are sent to
+func (f *FalService) Model() VideoModel {
+	return f.model
+}
+
+// ValidateVideoOutput checks that the video model can render the requested
+// aspect ratio and resolution
+func (f *FalService) ValidateVideoOutput(aspectRatio, resolution string) error {
+	if !contains(f.model.AspectRatios, aspectRatio) {
+		return fmt.Errorf("aspect ratio %s is not supported by %s (supported: %s)",
+			aspectRatio, f.model.ID, strings.Join(f.model.AspectRatios, ", "))
+	}
+	if !contains(f.model.Resolutions, resolution) {
+		return fmt.Errorf("resolution %s is not supported by %s (supported: %s)",
+			resolution, f.model.ID, strings.Join(f.model.Resolutions, ", "))
+	}
+	return nil
+}
+
+// AspectRatios returns the aspect ratios the video model renders
+func (f *FalService) AspectRatios() []string {
+	return f.model.AspectRatios
+}
+
+// DefaultResolution returns the resolution used when a request does not specify one
+func (f *FalService) DefaultResolution() string {
+	return f.model.Resolutions[0]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SoraSupportedDurations lists the clip lengths (in seconds) Sora 2 accepts
+var SoraSupportedDurations = []int{4, 8, 12}
+
+// NearestSupportedDuration snaps a requested duration to the closest length Sora 2 accepts
+func NearestSupportedDuration(duration int) int {
+	nearest := SoraSupportedDurations[0]
+	for _, d := range SoraSupportedDurations {
+		if abs(d-duration) < abs(nearest-duration) {
+			nearest = d
+		}
+	}
+	return nearest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
 type SoraGenerateRequest struct {
 	Prompt string `json:"prompt"`
 	// Add additional parameters as needed
 	AspectRatio string `json:"aspect_ratio,omitempty"` // e.g., "16:9", "9:16"
+	Resolution  string `json:"resolution,omitempty"`   // e.g., "720p", "1080p"
 	Duration    int    `json:"duration,omitempty"`     // Duration in seconds
 }
 
@@ -45,35 +145,64 @@ type SoraStatusResponse struct {
 	Output      map[string]interface{} `json:"output,omitempty"`
 }
 
-// GenerateVideo generates a video from text using Fal's Sora 2 model
-func (f *FalService) GenerateVideo(prompt string, duration int) (string, error) {
+// FalVideoStatus is the state of a queued Fal video generation request
+type FalVideoStatus struct {
+	Done     bool   // true once the request has finished, successfully or not
+	VideoURL string // set when the video completed successfully
+	Error    string // set when the generation failed
+}
+
+// FalWebhookPayload is the body Fal POSTs to the fal_webhook URL when a request finishes
+type FalWebhookPayload struct {
+	RequestID string                 `json:"request_id"`
+	Status    string                 `json:"status"` // "OK" or "ERROR"
+	Error     string                 `json:"error,omitempty"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+}
+
+// VideoURL extracts the generated video URL from a successful webhook payload
+func (p *FalWebhookPayload) VideoURL() (string, error) {
+	if p.Payload == nil {
+		return "", fmt.Errorf("webhook payload is empty")
+	}
+	videoURL, ok := extractVideoURL(p.Payload)
+	if !ok {
+		return "", fmt.Errorf("video URL not found in webhook payload")
+	}
+	return videoURL, nil
+}
+
+// SubmitVideo queues a video generation request with Fal's Sora 2 model and
+// returns the request ID. When webhookURL is set, Fal calls it once the video
+// is ready; otherwise the caller is expected to poll with CheckStatus.
+func (f *FalService) SubmitVideo(video SoraGenerateRequest, webhookURL string) (string, error) {
 	if f.apiKey == "" {
 		return "", fmt.Errorf("FAL_API_KEY not set")
 	}
 
-	// Submit the video generation request
-	requestID, err := f.submitRequest(prompt, duration)
-	if err != nil {
-		return "", fmt.Errorf("failed to submit request: %w", err)
+	if video.AspectRatio == "" {
+		video.AspectRatio = f.model.AspectRatios[0]
+	}
+	if video.Resolution == "" {
+		video.Resolution = f.model.Resolutions[0]
+	}
+	if err := f.ValidateVideoOutput(video.AspectRatio, video.Resolution); err != nil {
+		return "", err
 	}
 
-	// Poll for completion
-	videoURL, err := f.pollForCompletion(requestID)
+	requestID, err := f.submitRequest(video, webhookURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to get video: %w", err)
+		return "", fmt.Errorf("failed to submit request: %w", err)
 	}
 
-	return videoURL, nil
+	return requestID, nil
 }
 
-func (f *FalService) submitRequest(prompt string, duration int) (string, error) {
-	// Fal API endpoint for Sora 2
-	url := "https://queue.fal.run/fal-ai/sora-2"
-
-	reqBody := SoraGenerateRequest{
-		Prompt:      prompt,
-		AspectRatio: "16:9",
-		Duration:    duration,
+func (f *FalService) submitRequest(reqBody SoraGenerateRequest, webhookURL string) (string, error) {
+	// Fal API endpoint for the configured model
+	endpoint := fmt.Sprintf("https://queue.fal.run/%s", f.model.ID)
+	if webhookURL != "" {
+		endpoint += "?fal_webhook=" + url.QueryEscape(webhookURL)
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -81,7 +210,7 @@ func (f *FalService) submitRequest(prompt string, duration int) (string, error)
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -141,149 +270,152 @@ func (f *FalService) fetchVideoURL(responseURL string) (string, error) {
 		return "", fmt.Errorf("failed to parse result response: %w", err)
 	}
 
-	fmt.Printf("Fal API result response: %+v\n", result)
+	if videoURL, ok := extractVideoURL(result); ok {
+		return videoURL, nil
+	}
 
-	// Try to extract video URL from various possible locations in the Fal API response
-	// The structure might be: {"video": {"url": "..."}} or {"data": {"video": {"url": "..."}}}
+	return "", fmt.Errorf("video URL not found in result response: %s", string(body))
+}
+
+// extractVideoURL looks for the video URL in the various places Fal may put it.
+// The structure might be: {"video": {"url": "..."}} or {"data": {"video": {"url": "..."}}}
+func extractVideoURL(result map[string]interface{}) (string, bool) {
 	if video, ok := result["video"].(map[string]interface{}); ok {
 		if url, ok := video["url"].(string); ok {
-			fmt.Printf("Found video URL in result.video.url: %s\n", url)
-			return url, nil
+			return url, true
 		}
 	}
 	if data, ok := result["data"].(map[string]interface{}); ok {
 		if video, ok := data["video"].(map[string]interface{}); ok {
 			if url, ok := video["url"].(string); ok {
-				fmt.Printf("Found video URL in result.data.video.url: %s\n", url)
-				return url, nil
+				return url, true
 			}
 		}
 		if url, ok := data["url"].(string); ok {
-			fmt.Printf("Found video URL in result.data.url: %s\n", url)
-			return url, nil
+			return url, true
 		}
 	}
 	// Check if URL is at the top level
 	if url, ok := result["url"].(string); ok {
-		fmt.Printf("Found video URL in result.url: %s\n", url)
-		return url, nil
+		return url, true
 	}
 
-	return "", fmt.Errorf("video URL not found in result response: %s", string(body))
+	return "", false
 }
 
-func (f *FalService) pollForCompletion(requestID string) (string, error) {
-	url := fmt.Sprintf("https://queue.fal.run/fal-ai/sora-2/requests/%s/status", requestID)
-
-	// Poll for up to 5 minutes (60 attempts with 5 second intervals)
-	maxAttempts := 60
-	pollInterval := 5 * time.Second
+// CheckStatus polls Fal once for the state of a queued request. It is used as a
+// fallback for requests whose webhook never arrived.
+func (f *FalService) CheckStatus(requestID string) (*FalVideoStatus, error) {
+	statusURL := fmt.Sprintf("https://queue.fal.run/%s/requests/%s/status", f.model.QueueApp, requestID)
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		time.Sleep(pollInterval)
+	req, err := http.NewRequest("GET", statusURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create status request: %w", err)
+	}
 
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return "", fmt.Errorf("failed to create status request: %w", err)
-		}
+	req.Header.Set("Authorization", fmt.Sprintf("Key %s", f.apiKey))
 
-		req.Header.Set("Authorization", fmt.Sprintf("Key %s", f.apiKey))
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check status: %w", err)
+	}
 
-		resp, err := f.httpClient.Do(req)
-		if err != nil {
-			return "", fmt.Errorf("failed to check status: %w", err)
-		}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status response: %w", err)
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return "", fmt.Errorf("failed to read status response: %w", err)
-		}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return nil, fmt.Errorf("status request failed with status %d: %s", resp.StatusCode, string(body))
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("status request failed with status %d: %s", resp.StatusCode, string(body))
-		}
+	var status SoraStatusResponse
+	if err := json.Unmarshal(body, &status); err != nil {
+		return nil, fmt.Errorf("failed to parse status response: %w", err)
+	}
 
-		var status SoraStatusResponse
-		if err := json.Unmarshal(body, &status); err != nil {
-			return "", fmt.Errorf("failed to parse status response: %w", err)
+	switch status.Status {
+	case "COMPLETED":
+		// When completed, we need to fetch the actual result from the response_url
+		if status.ResponseURL != "" {
+			videoURL, err := f.fetchVideoURL(status.ResponseURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch video URL: %w", err)
+			}
+			return &FalVideoStatus{Done: true, VideoURL: videoURL}, nil
 		}
-
-		switch status.Status {
-		case "COMPLETED":
-			fmt.Printf("Video generation completed. Fetching result from: %s\n", status.ResponseURL)
-			// When completed, we need to fetch the actual result from the response_url
-			if status.ResponseURL != "" {
-				videoURL, err := f.fetchVideoURL(status.ResponseURL)
-				if err != nil {
-					return "", fmt.Errorf("failed to fetch video URL: %w", err)
-				}
-				return videoURL, nil
+		// Fallback: check if output is already present
+		if status.Output != nil {
+			if videoURL, ok := status.Output["video"].(string); ok {
+				return &FalVideoStatus{Done: true, VideoURL: videoURL}, nil
 			}
-			// Fallback: check if output is already present
-			if status.Output != nil {
-				if videoURL, ok := status.Output["video"].(string); ok {
-					return videoURL, nil
-				}
-				if videoURL, ok := status.Output["url"].(string); ok {
-					return videoURL, nil
-				}
+			if videoURL, ok := status.Output["url"].(string); ok {
+				return &FalVideoStatus{Done: true, VideoURL: videoURL}, nil
 			}
-			return "", fmt.Errorf("video completed but no URL found in response")
-		case "FAILED":
-			return "", fmt.Errorf("video generation failed: %s", status.Error)
-		case "PENDING", "PROCESSING":
-			// Continue polling
-			continue
-		default:
-			return "", fmt.Errorf("unknown status: %s", status.Status)
 		}
+		return &FalVideoStatus{Done: true, Error: "video completed but no URL found in response"}, nil
+	case "FAILED":
+		return &FalVideoStatus{Done: true, Error: fmt.Sprintf("video generation failed: %s", status.Error)}, nil
+	case "IN_QUEUE", "IN_PROGRESS", "PENDING", "PROCESSING":
+		return &FalVideoStatus{}, nil
+	default:
+		return nil, fmt.Errorf("unknown status: %s", status.Status)
 	}
+}
 
-	return "", fmt.Errorf("video generation timed out after %d attempts", maxAttempts)
+// ErrUnknownFalRequest is returned when a Fal result names a request that was
+// not submitted for the scene it is reported for
+var ErrUnknownFalRequest = errors.New("request was not submitted for this scene")
+
+// SignFalWebhook returns the signature that authenticates a webhook callback
+// for the given article scene
+func SignFalWebhook(secret string, articleID int64, sceneIndex int) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d:%d", articleID, sceneIndex)
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
-// DownloadVideo downloads the video from a URL and returns the file path
-func (f *FalService) DownloadVideo(videoURL string, articleID int) (string, error) {
+// VerifyFalWebhook checks a webhook signature produced by SignFalWebhook
+func VerifyFalWebhook(secret string, articleID int64, sceneIndex int, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	expected := SignFalWebhook(secret, articleID, sceneIndex)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
 
+// DownloadVideoTo downloads the video from a URL into the given file path
+func (f *FalService) DownloadVideoTo(videoURL string, filename string) error {
 	req, err := http.NewRequest("GET", videoURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create status request: %w", err)
+		return fmt.Errorf("failed to create download request: %w", err)
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Key %s", f.apiKey))
 
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to download video: %w", err)
+		return fmt.Errorf("failed to download video: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to download video: status %d", resp.StatusCode)
-	}
-
-	// Create videos directory if it doesn't exist
-	videosDir := "uploads/videos"
-	if err := os.MkdirAll(videosDir, 0755); err != nil {
-		return "", fmt.Errorf("failed to create videos directory: %w", err)
+		return fmt.Errorf("failed to download video: status %d", resp.StatusCode)
 	}
 
-	// Generate filename
-	filename := fmt.Sprintf("%s/article_%d_%d.mp4", videosDir, articleID, time.Now().Unix())
-
 	// Create the file
 	out, err := os.Create(filename)
 	if err != nil {
-		return "", fmt.Errorf("failed to create video file: %w", err)
+		return fmt.Errorf("failed to create video file: %w", err)
 	}
 	defer out.Close()
 
 	// Write the video content to file
 	_, err = io.Copy(out, resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to save video: %w", err)
+		return fmt.Errorf("failed to save video: %w", err)
 	}
 
-	return filename, nil
+	return nil
 }
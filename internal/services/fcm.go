@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/auth"
+	"cloud.google.com/go/auth/credentials"
+)
+
+const (
+	fcmEndpoint = "https://fcm.googleapis.com"
+	fcmScope    = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// FCMConfig configures Firebase Cloud Messaging for Android devices
+type FCMConfig struct {
+	// CredentialsFile is a service account key of the Firebase project.
+	// Application Default Credentials are used when it is empty.
+	CredentialsFile string
+	ProjectID       string // defaults to the project of the credentials
+
+	// DeepLinkScheme is the app's URL scheme, for deep links such as
+	// pocketscribe://articles/42
+	DeepLinkScheme string
+
+	// Endpoint replaces the FCM host, e.g. with a local stub in tests.
+	// Client replaces the HTTP client used to reach it.
+	Endpoint string
+	Client   *http.Client
+}
+
+// FCMService sends notifications through the FCM HTTP v1 API
+type FCMService struct {
+	credentials    *auth.Credentials
+	projectID      string
+	endpoint       string
+	deepLinkScheme string
+	client         *http.Client
+}
+
+// fcmMessage is the message of an FCM send request
+type fcmMessage struct {
+	Token        string            `json:"token"`
+	Notification fcmNotification   `json:"notification"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      fcmAndroidConfig  `json:"android"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Image string `json:"image,omitempty"`
+}
+
+type fcmAndroidConfig struct {
+	Priority     string                 `json:"priority"`
+	CollapseKey  string                 `json:"collapse_key,omitempty"`
+	Notification fcmAndroidNotification `json:"notification"`
+}
+
+type fcmAndroidNotification struct {
+	ChannelID         string `json:"channel_id,omitempty"`
+	Tag               string `json:"tag,omitempty"`
+	NotificationCount *int   `json:"notification_count,omitempty"`
+}
+
+// NewFCMService creates an FCM service authenticated with the Firebase
+// project's service account
+func NewFCMService(cfg FCMConfig) (*FCMService, error) {
+	creds, err := credentials.DetectDefault(&credentials.DetectOptions{
+		Scopes:          []string{fcmScope},
+		CredentialsFile: cfg.CredentialsFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load FCM credentials: %w", err)
+	}
+
+	projectID := cfg.ProjectID
+	if projectID == "" {
+		projectID, err = creds.ProjectID(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("failed to get FCM project ID: %w", err)
+		}
+		if projectID == "" {
+			return nil, fmt.Errorf("FCM project ID is required")
+		}
+	}
+
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = fcmEndpoint
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	deepLinkScheme := cfg.DeepLinkScheme
+	if deepLinkScheme == "" {
+		deepLinkScheme = "pocketscribe"
+	}
+
+	return &FCMService{
+		credentials:    creds,
+		projectID:      projectID,
+		endpoint:       endpoint,
+		deepLinkScheme: deepLinkScheme,
+		client:         client,
+	}, nil
+}
+
+// Channel returns ChannelFCM
+func (s *FCMService) Channel() string {
+	return ChannelFCM
+}
+
+// Notify sends a notification to an Android device. The app reads the event,
+// article ID and deep link from the data, and shows each event in its own
+// notification channel.
+func (s *FCMService) Notify(ctx context.Context, device Recipient, notification Notification) error {
+	title := notification.Title
+	if notification.Subtitle != "" {
+		title = fmt.Sprintf("%s: %s", notification.Title, notification.Subtitle)
+	}
+
+	badge := notification.Badge
+	message := fcmMessage{
+		Token: device.Address,
+		Notification: fcmNotification{
+			Title: title,
+			Body:  notification.Body,
+		},
+		Data: map[string]string{
+			"event":     notification.Event,
+			"deep_link": fmt.Sprintf("%s://articles", s.deepLinkScheme),
+		},
+		Android: fcmAndroidConfig{
+			Priority: "high",
+			Notification: fcmAndroidNotification{
+				ChannelID:         notification.Event,
+				NotificationCount: &badge,
+			},
+		},
+	}
+
+	if article := notification.Article; article != nil {
+		message.Notification.Image = article.ThumbnailURL
+		message.Data["article_id"] = strconv.FormatInt(article.ArticleID, 10)
+		message.Data["format"] = article.Format
+		message.Data["deep_link"] = fmt.Sprintf("%s://articles/%d", s.deepLinkScheme, article.ArticleID)
+		// A failure followed by success replaces the failure on the device
+		message.Android.Notification.Tag = fmt.Sprintf("article-%d", article.ArticleID)
+	} else {
+		message.Android.CollapseKey = notification.Event
+		message.Android.Notification.Tag = notification.Event
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"message": message})
+	if err != nil {
+		return fmt.Errorf("failed to marshal FCM message: %w", err)
+	}
+
+	token, err := s.credentials.Token(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get FCM access token: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/projects/%s/messages:send", s.endpoint, s.projectID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errorResponse struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+				Details []struct {
+					ErrorCode string `json:"errorCode"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&errorResponse)
+
+		reason := errorResponse.Error.Status
+		for _, detail := range errorResponse.Error.Details {
+			if detail.ErrorCode != "" {
+				reason = detail.ErrorCode
+			}
+		}
+		log.Printf("FCM: Failed to send notification. Status: %d, Reason: %s", resp.StatusCode, reason)
+
+		// The app was uninstalled or the token was rotated
+		if resp.StatusCode == http.StatusNotFound || reason == "UNREGISTERED" {
+			return fmt.Errorf("%w: FCM returned status %d: %s", ErrDeviceTokenInvalid, resp.StatusCode, reason)
+		}
+		return fmt.Errorf("FCM returned status %d: %s: %s", resp.StatusCode, reason, errorResponse.Error.Message)
+	}
+
+	log.Printf("FCM: Successfully sent notification to device %s", device.Address)
+	return nil
+}
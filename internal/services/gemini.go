@@ -1,84 +1,51 @@
 package services
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
 	"strings"
 
-	"google.golang.org/genai"
-
 	"github.com/PuerkitoBio/goquery"
 )
 
+// GeminiService builds the prompts for every language model task in the
+// pipeline. The model calls themselves go through an LLMProvider.
 type GeminiService struct {
-	apiKey      string
-	client      *http.Client
-	genaiClient *genai.Client
+	provider  LLMProvider
+	models    LLMModels
+	summarize SummarizeOptions
 }
 
-func NewGeminiService(apiKey string) *GeminiService {
-	// Set the API key as environment variable for the genai client
-	os.Setenv("GEMINI_API_KEY", apiKey)
-
-	ctx := context.Background()
-	genaiClient, err := genai.NewClient(ctx, nil)
-	if err != nil {
-		log.Printf("Warning: Failed to create genai client: %v", err)
-		genaiClient = nil
-	}
-
+func NewGeminiService(provider LLMProvider, models LLMModels, summarize SummarizeOptions) *GeminiService {
 	return &GeminiService{
-		apiKey:      apiKey,
-		client:      &http.Client{},
-		genaiClient: genaiClient,
+		provider:  provider,
+		models:    models,
+		summarize: summarize,
 	}
 }
 
-type geminiRequest struct {
-	Contents []geminiContent `json:"contents"`
-}
-
-type geminiContent struct {
-	Parts []geminiPart `json:"parts"`
-}
-
-type geminiPart struct {
-	Text string `json:"text"`
-}
-
-type geminiResponse struct {
-	Candidates []struct {
-		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-		} `json:"content"`
-	} `json:"candidates"`
-}
-
 // SummarizeArticle fetches and summarizes an article from a URL
 // length: "s" (1min), "m" (5min), "l" (full article)
 // style: "summarize" (default), "explain", "simplify", etc.
-func (g *GeminiService) SummarizeArticle(url string, length string, language string, style string) (string, string, error) {
+func (g *GeminiService) SummarizeArticle(url string, length string, language string, style string) (*ArticleSummary, error) {
 	// First, extract the article content from the webpage
 	content, err := g.extractArticleContent(url)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to extract article: %w", err)
+		return nil, fmt.Errorf("failed to extract article: %w", err)
 	}
 
 	// Then summarize based on length and style
-	summary, err := g.summarize(content, length, language, style)
+	speech, display, err := g.summarizeContent(content, length, language, style)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to summarize: %w", err)
+		return nil, fmt.Errorf("failed to summarize: %w", err)
 	}
 
-	return content, summary, nil
+	return &ArticleSummary{
+		Content: content,
+		Speech:  speech,
+		Display: display,
+	}, nil
 }
 
 const PROMPT = `Extract the main article content from this URL: %s
@@ -122,158 +89,24 @@ func (g *GeminiService) extractArticleContent(url string) (string, error) {
 		return "", fmt.Errorf("no text extracted from HTML")
 	}
 
-	// 3. Ask Gemini to clean it up
-	prompt := fmt.Sprintf(
-		"Clean and summarize the following article text. Remove navigation menus, ads, and unrelated content:\n\n%s",
-		extractedText,
-	)
-
-	reqBody := geminiRequest{
-		Contents: []geminiContent{
-			{
-				Parts: []geminiPart{
-					{Text: prompt},
-				},
-			},
-		},
+	// 3. Ask Gemini to clean it up, one section at a time for pages too long for one prompt
+	sections := []Section{{Text: extractedText}}
+	if EstimateTokens(extractedText) > g.summarize.maxInputTokens() {
+		sections = ChunkContent(extractedText, g.summarize.chunkTokens())
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
-
-	apiURL := fmt.Sprintf(
-		"https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-pro:generateContent?key=%s",
-		g.apiKey,
-	)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp2, err := g.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp2.Body.Close()
-
-	body, err := io.ReadAll(resp2.Body)
+	cleaned, err := g.mapSections(sections, func(section Section) (string, error) {
+		prompt := fmt.Sprintf(
+			"Clean and summarize the following article text. Remove navigation menus, ads, and unrelated content:\n\n%s",
+			section.Text,
+		)
+		return g.provider.Generate(context.Background(), g.models.Summarize, prompt, GenerateOptions{})
+	})
 	if err != nil {
 		return "", err
 	}
 
-	if resp2.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("gemini API error: %s - %s", resp2.Status, string(body))
-	}
-
-	var geminiResp geminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", err
-	}
-
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
-
-	return geminiResp.Candidates[0].Content.Parts[0].Text, nil
-}
-
-func (g *GeminiService) summarize(content string, length string, language string, style string) (string, error) {
-	var targetLength string
-	switch length {
-	case "s":
-		targetLength = "approximately 1 minute of reading time (about 150-200 words)"
-	case "m":
-		targetLength = "approximately 5 minutes of reading time (about 750-1000 words)"
-	case "l":
-		targetLength = "keep the full article content, but clean it up and organize it well"
-	default:
-		targetLength = "approximately 5 minutes of reading time"
-	}
-
-	// Default style is summarize if not provided
-	if style == "" {
-		style = "summarize"
-	}
-
-	// Build style-specific instruction
-	styleInstruction := style
-
-	if language != "" {
-		styleInstruction += fmt.Sprintf(" In language [%s]", language)
-	}
-
-	prompt := fmt.Sprintf(`%s to %s
-
-IMPORTANT: This summary will be converted to speech, so:
-- Use only spoken language and natural phrasing
-- Avoid special characters, symbols, URLs, hashtags, and markdown formatting
-- Avoid parentheses, brackets, asterisks, underscores, and other punctuation marks that aren't naturally spoken
-- Use periods for natural pauses between sentences
-- Use commas for shorter pauses within sentences
-- Spell out numbers, percentages, and abbreviations (e.g., "ten percent" not "10%%", "doctor" not "Dr.")
-- Write out acronyms on first use, then use the full term
-- Use complete sentences with clear, natural flow
-- Organize with paragraph breaks (blank lines) to indicate longer pauses between topics
-- Be conversational and engaging, as if explaining to a listener
-- Return ONLY the summary text, nothing else
-
-Article content:
-%s
-
-Summary:`, styleInstruction, targetLength, content)
-
-	reqBody := geminiRequest{
-		Contents: []geminiContent{
-			{
-				Parts: []geminiPart{
-					{Text: prompt},
-				},
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
-
-	apiURL := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-pro:generateContent?key=%s", g.apiKey)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", err
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := g.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("gemini API error: %s - %s", resp.Status, string(body))
-	}
-
-	var geminiResp geminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", err
-	}
-
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
-
-	summary := geminiResp.Candidates[0].Content.Parts[0].Text
-	return strings.TrimSpace(summary), nil
+	return strings.Join(cleaned, "\n\n"), nil
 }
 
 // GenerateTitle generates a concise title from the article content
@@ -291,184 +124,88 @@ Article content:
 
 Title:`, contentSnippet)
 
-	reqBody := geminiRequest{
-		Contents: []geminiContent{
-			{
-				Parts: []geminiPart{
-					{Text: prompt},
-				},
-			},
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", err
-	}
-
-	apiURL := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-pro:generateContent?key=%s", g.apiKey)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	title, err := g.provider.Generate(context.Background(), g.models.Title, prompt, GenerateOptions{})
 	if err != nil {
 		return "", err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := g.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("gemini API error: %s - %s", resp.Status, string(body))
-	}
-
-	var geminiResp geminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", err
-	}
-
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
-
-	title := geminiResp.Candidates[0].Content.Parts[0].Text
 	// Clean up the title - remove quotes and extra whitespace
 	title = strings.Trim(strings.TrimSpace(title), "\"'")
 	return title, nil
 }
 
-// GenerateThumbnail generates a thumbnail image from text using Imagen via Gemini SDK
-func (g *GeminiService) GenerateThumbnail(summary string) ([]byte, error) {
-	if g.genaiClient == nil {
-		return nil, fmt.Errorf("genai client not initialized")
-	}
-
+// GenerateThumbnail generates a thumbnail image from text using Imagen via Gemini SDK,
+// framed for the article's aspect ratio
+func (g *GeminiService) GenerateThumbnail(summary string, aspectRatio string) ([]byte, error) {
 	// Create a concise image prompt from the summary (limit to 500 chars)
 	summarySnippet := summary
 	if len(summary) > 500 {
 		summarySnippet = summary[:500]
 	}
 
-	prompt := fmt.Sprintf(`Create a professional, visually appealing thumbnail image for an article. The image should be abstract and artistic, representing the following content: %s. Style: modern, clean, professional, eye-catching.`, summarySnippet)
-
-	ctx := context.Background()
-
-	// Use the Gemini 2.5 Flash Image model for image generation
-	result, err := g.genaiClient.Models.GenerateContent(
-		ctx,
-		"gemini-2.5-flash-image",
-		genai.Text(prompt),
-		nil, // config parameter
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate image: %w", err)
-	}
-
-	// Extract the image data from the response
-	if len(result.Candidates) == 0 {
-		return nil, fmt.Errorf("no candidates in response")
-	}
-
-	for _, part := range result.Candidates[0].Content.Parts {
-		if part.InlineData != nil {
-			imageBytes := part.InlineData.Data
-			return imageBytes, nil
-		}
-	}
+	prompt := fmt.Sprintf(`Create a professional, visually appealing thumbnail image for an article. The image should be abstract and artistic, representing the following content: %s. Style: modern, clean, professional, eye-catching. %s`, summarySnippet, framingInstruction(aspectRatio))
 
-	return nil, fmt.Errorf("no image data in response")
+	return g.provider.GenerateImage(context.Background(), g.models.Thumbnail, prompt, ImageOptions{AspectRatio: aspectRatio})
 }
 
-// ChatMessage represents a single message in a chat conversation
-type ChatMessage struct {
-	Role    string `json:"role"`    // "user" or "assistant"
-	Content string `json:"content"` // The message content
+// framingInstruction tells the model how to compose a shot for the aspect ratio
+func framingInstruction(aspectRatio string) string {
+	switch aspectRatio {
+	case "9:16":
+		return "Compose for a vertical 9:16 frame, keeping the subject centered for phone screens."
+	case "1:1":
+		return "Compose for a square 1:1 frame with the subject centered."
+	default:
+		return "Compose for a horizontal 16:9 frame."
+	}
 }
 
 // ChatWithArticle generates a response to a user's question about an article
-// using the article content as context and considering the chat history
-func (g *GeminiService) ChatWithArticle(articleContent string, chatHistory []ChatMessage, userMessage string) (string, error) {
-	// Build the conversation context with the article content
-	systemPrompt := fmt.Sprintf(`You are a helpful assistant that answers questions about the following article. Use the article content to provide accurate, informative answers. If the question cannot be answered using the article content, politely let the user know.
-
-Article Content:
-%s
-
-Please provide clear, concise, and helpful responses based on this article.`, articleContent)
-
-	// Build the conversation history for Gemini
-	contents := []geminiContent{
-		{
-			Parts: []geminiPart{
-				{Text: systemPrompt},
-			},
-		},
-	}
-
-	// Add chat history
-	for _, msg := range chatHistory {
-		contents = append(contents, geminiContent{
-			Parts: []geminiPart{
-				{Text: fmt.Sprintf("%s: %s", msg.Role, msg.Content)},
-			},
-		})
-	}
-
-	// Add the current user message
-	contents = append(contents, geminiContent{
-		Parts: []geminiPart{
-			{Text: fmt.Sprintf("user: %s", userMessage)},
-		},
-	})
-
-	reqBody := geminiRequest{
-		Contents: contents,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+// using the article content as context and considering the chat history. The
+// answer cites the article paragraphs that support it.
+func (g *GeminiService) ChatWithArticle(articleContent string, chatHistory []ChatMessage, userMessage string) (*ChatAnswer, error) {
+	response, err := g.provider.Chat(context.Background(), g.models.Chat, chatSystemPrompt(articleContent), chatMessages(chatHistory, userMessage), GenerateOptions{})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	apiURL := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-pro:generateContent?key=%s", g.apiKey)
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	return parseChatAnswer(response, articleContent), nil
+}
+
+// ChatWithArticleStream is like ChatWithArticle, but calls onChunk with each
+// piece of the raw response, citation markers included, as it is generated
+func (g *GeminiService) ChatWithArticleStream(ctx context.Context, articleContent string, chatHistory []ChatMessage, userMessage string, onChunk func(string) error) (*ChatAnswer, error) {
+	response, err := g.provider.ChatStream(ctx, g.models.Chat, chatSystemPrompt(articleContent), chatMessages(chatHistory, userMessage), GenerateOptions{}, onChunk)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	return parseChatAnswer(response, articleContent), nil
+}
 
-	resp, err := g.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+// chatSystemPrompt builds the conversation context with the numbered article
+// paragraphs the answer must cite
+func chatSystemPrompt(articleContent string) string {
+	return fmt.Sprintf(`You are a helpful assistant that answers questions about the following article. Use the article content to provide accurate, informative answers. If the question cannot be answered using the article content, politely let the user know.
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
+Each paragraph of the article starts with a marker such as [P1].
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("gemini API error: %s - %s", resp.Status, string(body))
-	}
+Article Content:
+%s
 
-	var geminiResp geminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return "", err
-	}
+Please provide clear, concise, and helpful responses based on this article.
 
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
+Cite your sources:
+- After each sentence that uses the article, add the markers of the paragraphs that support it, e.g. "The plan costs less than expected [P4][P7]."
+- Only cite paragraphs that actually support the sentence.
+- If any part of your answer relies on knowledge that is not in the article, add the marker %s at the very end of your answer.
+- Do not use markers anywhere else.`, numberedArticle(articleContent), outsideArticleMarker)
+}
 
-	response := geminiResp.Candidates[0].Content.Parts[0].Text
-	return strings.TrimSpace(response), nil
+// chatMessages adds the current user message after the chat history
+func chatMessages(chatHistory []ChatMessage, userMessage string) []ChatMessage {
+	return append(append([]ChatMessage{}, chatHistory...), ChatMessage{
+		Role:    "user",
+		Content: userMessage,
+	})
 }
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+const geminiAPIBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiProvider is an LLMProvider backed by the Gemini API
+type GeminiProvider struct {
+	apiKey      string
+	client      *http.Client
+	genaiClient *genai.Client
+}
+
+func NewGeminiProvider(apiKey string) *GeminiProvider {
+	ctx := context.Background()
+	genaiClient, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  apiKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create genai client: %v", err)
+		genaiClient = nil
+	}
+
+	return &GeminiProvider{
+		apiKey:      apiKey,
+		client:      &http.Client{},
+		genaiClient: genaiClient,
+	}
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiGenerationConfig struct {
+	ResponseMIMEType   string                 `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema map[string]interface{} `json:"responseJsonSchema,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+		} `json:"content"`
+	} `json:"candidates"`
+}
+
+// Generate sends a single prompt to the model
+func (p *GeminiProvider) Generate(ctx context.Context, model string, prompt string, opts GenerateOptions) (string, error) {
+	reqBody := geminiRequest{
+		Contents: []geminiContent{
+			{
+				Role: "user",
+				Parts: []geminiPart{
+					{Text: prompt},
+				},
+			},
+		},
+		GenerationConfig: generationConfig(opts),
+	}
+
+	return p.generateContent(ctx, model, reqBody)
+}
+
+// Chat sends a conversation to the model with the system prompt as system instructions
+func (p *GeminiProvider) Chat(ctx context.Context, model string, system string, history []ChatMessage, opts GenerateOptions) (string, error) {
+	return p.generateContent(ctx, model, chatRequest(system, history, opts))
+}
+
+// ChatStream sends a conversation to the model and streams the reply using
+// streamGenerateContent with server-sent events
+func (p *GeminiProvider) ChatStream(ctx context.Context, model string, system string, history []ChatMessage, opts GenerateOptions, onChunk func(string) error) (string, error) {
+	jsonData, err := json.Marshal(chatRequest(system, history, opts))
+	if err != nil {
+		return "", err
+	}
+
+	apiURL := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", geminiAPIBaseURL, model)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("gemini API error: %s - %s", resp.Status, string(body))
+	}
+
+	// Each event carries a partial response with the next piece of text
+	var reply strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+			return "", fmt.Errorf("failed to parse stream event: %w", err)
+		}
+		if len(chunk.Candidates) == 0 {
+			continue
+		}
+
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			reply.WriteString(part.Text)
+			if err := onChunk(part.Text); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	if reply.Len() == 0 {
+		return "", fmt.Errorf("no content in response")
+	}
+	return strings.TrimSpace(reply.String()), nil
+}
+
+// GenerateImage generates an image using the Gemini SDK
+func (p *GeminiProvider) GenerateImage(ctx context.Context, model string, prompt string, opts ImageOptions) ([]byte, error) {
+	if p.genaiClient == nil {
+		return nil, fmt.Errorf("genai client not initialized")
+	}
+
+	var config *genai.GenerateContentConfig
+	if opts.AspectRatio != "" {
+		config = &genai.GenerateContentConfig{
+			ImageConfig: &genai.ImageConfig{AspectRatio: opts.AspectRatio},
+		}
+	}
+
+	result, err := p.genaiClient.Models.GenerateContent(ctx, model, genai.Text(prompt), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate image: %w", err)
+	}
+
+	// Extract the image data from the response
+	if len(result.Candidates) == 0 || result.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("no candidates in response")
+	}
+
+	for _, part := range result.Candidates[0].Content.Parts {
+		if part.InlineData != nil {
+			return part.InlineData.Data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no image data in response")
+}
+
+type geminiEmbedRequest struct {
+	Requests []geminiEmbedContentRequest `json:"requests"`
+}
+
+type geminiEmbedContentRequest struct {
+	Model                string        `json:"model"`
+	Content              geminiContent `json:"content"`
+	TaskType             string        `json:"taskType,omitempty"`
+	OutputDimensionality int           `json:"outputDimensionality,omitempty"`
+}
+
+type geminiEmbedResponse struct {
+	Embeddings []struct {
+		Values []float32 `json:"values"`
+	} `json:"embeddings"`
+}
+
+// geminiEmbedBatchSize is the most texts batchEmbedContents accepts at once
+const geminiEmbedBatchSize = 100
+
+// Embed embeds texts with batchEmbedContents
+func (p *GeminiProvider) Embed(ctx context.Context, model string, texts []string, opts EmbedOptions) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += geminiEmbedBatchSize {
+		end := start + geminiEmbedBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+
+		reqBody := geminiEmbedRequest{}
+		for _, text := range texts[start:end] {
+			reqBody.Requests = append(reqBody.Requests, geminiEmbedContentRequest{
+				Model:                "models/" + model,
+				Content:              geminiContent{Parts: []geminiPart{{Text: text}}},
+				TaskType:             opts.TaskType,
+				OutputDimensionality: opts.Dimensions,
+			})
+		}
+
+		jsonData, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, err
+		}
+
+		apiURL := fmt.Sprintf("%s/models/%s:batchEmbedContents", geminiAPIBaseURL, model)
+		req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-goog-api-key", p.apiKey)
+
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("gemini API error: %s - %s", resp.Status, string(body))
+		}
+
+		var embedResp geminiEmbedResponse
+		if err := json.Unmarshal(body, &embedResp); err != nil {
+			return nil, err
+		}
+		if len(embedResp.Embeddings) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(embedResp.Embeddings))
+		}
+
+		// Truncated Gemini embeddings are not normalized
+		for _, embedding := range embedResp.Embeddings {
+			vectors = append(vectors, normalizeVector(embedding.Values))
+		}
+	}
+
+	return vectors, nil
+}
+
+// generateContent sends a request to the Gemini API and returns the text of the first candidate
+func (p *GeminiProvider) generateContent(ctx context.Context, model string, reqBody geminiRequest) (string, error) {
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", err
+	}
+
+	apiURL := fmt.Sprintf("%s/models/%s:generateContent", geminiAPIBaseURL, model)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", p.apiKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gemini API error: %s - %s", resp.Status, string(body))
+	}
+
+	var geminiResp geminiResponse
+	if err := json.Unmarshal(body, &geminiResp); err != nil {
+		return "", err
+	}
+
+	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
+		return "", fmt.Errorf("no content in response")
+	}
+
+	return strings.TrimSpace(geminiResp.Candidates[0].Content.Parts[0].Text), nil
+}
+
+func generationConfig(opts GenerateOptions) *geminiGenerationConfig {
+	if !opts.JSON && opts.Schema == nil {
+		return nil
+	}
+	return &geminiGenerationConfig{
+		ResponseMIMEType:   "application/json",
+		ResponseJSONSchema: opts.Schema,
+	}
+}
+
+func chatRequest(system string, history []ChatMessage, opts GenerateOptions) geminiRequest {
+	reqBody := geminiRequest{
+		Contents:         chatContents(history),
+		GenerationConfig: generationConfig(opts),
+	}
+	if system != "" {
+		reqBody.SystemInstruction = &geminiContent{
+			Parts: []geminiPart{
+				{Text: system},
+			},
+		}
+	}
+	return reqBody
+}
+
+// chatContents maps chat messages onto Gemini's "user" and "model" roles
+func chatContents(history []ChatMessage) []geminiContent {
+	contents := make([]geminiContent, 0, len(history))
+	for _, msg := range history {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+		contents = append(contents, geminiContent{
+			Role: role,
+			Parts: []geminiPart{
+				{Text: msg.Content},
+			},
+		})
+	}
+	return contents
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LibraryAnswer is a reply to a question about the user's whole library,
+// with citations into the articles it draws on
+type LibraryAnswer struct {
+	Content   string            `json:"content"`
+	Citations []LibraryCitation `json:"citations"`
+	// OutsideLibrary is set when part of the answer is not supported by the sources
+	OutsideLibrary bool `json:"outside_library"`
+}
+
+// LibraryCitation points a claim in the answer at a passage of an article.
+// Start and End are character offsets of the passage in the article's
+// original content; AnswerOffset is where the claim ends in the answer.
+type LibraryCitation struct {
+	ArticleID    int64   `json:"article_id"`
+	Title        *string `json:"title,omitempty"`
+	ChunkIndex   int     `json:"chunk_index"`
+	Start        int     `json:"start"`
+	End          int     `json:"end"`
+	AnswerOffset int     `json:"answer_offset"`
+}
+
+// sourceMarker matches library source markers such as [S2] or [S2, S5]
+var sourceMarker = regexp.MustCompile(`\[S\d+(?:\s*,\s*S?\d+)*\]`)
+
+// EmbedDocuments embeds article passages for storage in the vector index
+func (g *GeminiService) EmbedDocuments(ctx context.Context, texts []string) ([][]float32, error) {
+	return g.provider.Embed(ctx, g.models.Embed, texts, EmbedOptions{
+		TaskType:   "RETRIEVAL_DOCUMENT",
+		Dimensions: g.models.EmbedDimensions,
+	})
+}
+
+// EmbedQuery embeds a search query
+func (g *GeminiService) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	vectors, err := g.provider.Embed(ctx, g.models.Embed, []string{query}, EmbedOptions{
+		TaskType:   "RETRIEVAL_QUERY",
+		Dimensions: g.models.EmbedDimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("expected 1 embedding, got %d", len(vectors))
+	}
+	return vectors[0], nil
+}
+
+// ChatWithLibrary answers a question from passages retrieved across the
+// user's articles, citing the passages it uses
+func (g *GeminiService) ChatWithLibrary(ctx context.Context, sources []ChunkMatch, chatHistory []ChatMessage, userMessage string) (*LibraryAnswer, error) {
+	var b strings.Builder
+	for i, source := range sources {
+		title := "Untitled Article"
+		if source.Title != nil && *source.Title != "" {
+			title = *source.Title
+		}
+		fmt.Fprintf(&b, "[S%d] From \"%s\":\n%s\n\n", i+1, title, source.Text)
+	}
+
+	systemPrompt := fmt.Sprintf(`You are a helpful assistant that answers questions about the articles the user has saved. Below are the passages from their library that are most relevant to the conversation. Each passage starts with a marker such as [S1] and the title of its article.
+
+Sources:
+%s
+Answer from these sources. If they do not answer the question, say that the saved articles do not cover it.
+
+Cite your sources:
+- After each sentence that uses a source, add the markers of the passages that support it, e.g. "Both articles recommend HNSW indexes [S2][S5]."
+- Only cite passages that actually support the sentence.
+- If any part of your answer relies on knowledge that is not in the sources, add the marker %s at the very end of your answer.
+- Do not use markers anywhere else.`, strings.TrimSpace(b.String()), outsideArticleMarker)
+
+	response, err := g.provider.Chat(ctx, g.models.Chat, systemPrompt, chatMessages(chatHistory, userMessage), GenerateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	content, refs, outside := stripCitationMarkers(response, sourceMarker, "S")
+	answer := &LibraryAnswer{Content: content, Citations: []LibraryCitation{}, OutsideLibrary: outside}
+	for _, ref := range refs {
+		if ref.number < 1 || ref.number > len(sources) {
+			continue
+		}
+		source := sources[ref.number-1]
+		citation := LibraryCitation{
+			ArticleID:    source.ArticleID,
+			Title:        source.Title,
+			ChunkIndex:   source.ChunkIndex,
+			Start:        source.Start,
+			End:          source.End,
+			AnswerOffset: ref.answerOffset,
+		}
+		if !containsLibraryCitation(answer.Citations, citation) {
+			answer.Citations = append(answer.Citations, citation)
+		}
+	}
+
+	return answer, nil
+}
+
+func containsLibraryCitation(citations []LibraryCitation, citation LibraryCitation) bool {
+	for _, c := range citations {
+		if c.ArticleID == citation.ArticleID && c.ChunkIndex == citation.ChunkIndex && c.AnswerOffset == citation.AnswerOffset {
+			return true
+		}
+	}
+	return false
+}
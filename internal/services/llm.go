@@ -0,0 +1,61 @@
+package services
+
+import "context"
+
+// LLMProvider is a language model backend. GeminiService builds the prompts for
+// each task and delegates the model calls to a provider, so models can be
+// swapped per task and tests can run against a deterministic fake.
+type LLMProvider interface {
+	// Generate returns the model's response to a single prompt
+	Generate(ctx context.Context, model string, prompt string, opts GenerateOptions) (string, error)
+
+	// Chat returns the model's reply to a conversation, given system instructions
+	Chat(ctx context.Context, model string, system string, history []ChatMessage, opts GenerateOptions) (string, error)
+
+	// ChatStream is like Chat, but calls onChunk with each piece of the reply
+	// as it is generated. It returns the full reply, and stops early if
+	// onChunk returns an error.
+	ChatStream(ctx context.Context, model string, system string, history []ChatMessage, opts GenerateOptions, onChunk func(string) error) (string, error)
+
+	// GenerateImage returns PNG image data generated from a prompt
+	GenerateImage(ctx context.Context, model string, prompt string, opts ImageOptions) ([]byte, error)
+
+	// Embed returns one unit-length embedding vector per text, in order
+	Embed(ctx context.Context, model string, texts []string, opts EmbedOptions) ([][]float32, error)
+}
+
+// GenerateOptions tunes a text generation request
+type GenerateOptions struct {
+	// JSON asks the model to respond with JSON only
+	JSON bool
+	// Schema is an optional JSON schema the response must follow (implies JSON)
+	Schema map[string]interface{}
+}
+
+// ImageOptions tunes an image generation request
+type ImageOptions struct {
+	AspectRatio string // e.g. "16:9", "9:16", "1:1"
+}
+
+// EmbedOptions tunes an embedding request
+type EmbedOptions struct {
+	TaskType   string // "RETRIEVAL_DOCUMENT" or "RETRIEVAL_QUERY"
+	Dimensions int    // length of each vector
+}
+
+// LLMModels selects the model used for each task
+type LLMModels struct {
+	Summarize string // content extraction, summaries and storyboards
+	Title     string
+	Chat      string
+	Thumbnail string
+	Embed     string // embeddings for semantic search
+
+	EmbedDimensions int
+}
+
+// ChatMessage represents a single message in a chat conversation
+type ChatMessage struct {
+	Role    string `json:"role"`    // "user" or "assistant"
+	Content string `json:"content"` // The message content
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStorage stores files in a directory on disk, for local development
+// and tests. Files are served by the /files/ route, which only accepts URLs
+// signed with the storage's secret.
+type LocalStorage struct {
+	root    string
+	baseURL string
+	secret  []byte
+}
+
+// NewLocalStorage creates a storage rooted at dir whose files are served
+// under baseURL (e.g. "http://localhost:8080/files"). Without a secret, a
+// random one is generated and signed URLs only last until restart.
+func NewLocalStorage(dir, baseURL, secret string) (*LocalStorage, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve storage directory: %w", err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate signing secret: %w", err)
+		}
+	}
+
+	return &LocalStorage{
+		root:    root,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		secret:  key,
+	}, nil
+}
+
+// Upload streams a file to disk. The file is written under a temporary name
+// and renamed, so readers never see a partial file.
+func (s *LocalStorage) Upload(ctx context.Context, key string, body io.Reader, contentType string) error {
+	filename, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+// Download opens a file on disk for streaming
+func (s *LocalStorage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, _, err := s.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// DownloadRange opens part of a file on disk for streaming
+func (s *LocalStorage) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	file, _, err := s.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+// Delete removes a file from disk. Deleting a missing file is not an error.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	filename, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+// Move renames a file on disk
+func (s *LocalStorage) Move(ctx context.Context, src, dst string) error {
+	srcName, err := s.path(src)
+	if err != nil {
+		return err
+	}
+	dstName, err := s.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstName), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := os.Rename(srcName, dstName); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to move file: %w", err)
+	}
+
+	return nil
+}
+
+// Stat returns the size, type and version of a file
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	filename, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filename)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return localFileInfo(key, info), nil
+}
+
+// List returns the files whose keys start with prefix
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	files := []FileInfo{}
+	err := filepath.WalkDir(s.root, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, filename)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, *localFileInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return files, nil
+}
+
+// SignedURL returns a /files/ URL for key that expires after ttl
+func (s *LocalStorage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	expires := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.sign(key, expires))
+	return s.baseURL + "/" + key + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL reports whether expires and signature, taken from a URL
+// returned by SignedURL, grant access to key now
+func (s *LocalStorage) VerifySignedURL(key, expires, signature string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(s.sign(key, expiresAt)), []byte(signature))
+}
+
+func (s *LocalStorage) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Open opens a file for serving
+func (s *LocalStorage) Open(key string) (*os.File, *FileInfo, error) {
+	filename, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, nil, ErrFileNotFound
+	}
+
+	return file, localFileInfo(key, info), nil
+}
+
+// RemoveStaleUploads deletes temporary files left behind by uploads that
+// were interrupted before, and returns how many were removed
+func (s *LocalStorage) RemoveStaleUploads(before time.Time) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(s.root, func(filename string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(before) {
+			return nil
+		}
+		if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return removed, fmt.Errorf("failed to remove stale uploads: %w", err)
+	}
+	return removed, nil
+}
+
+// path maps a key onto a file under the storage root, rejecting keys that
+// would escape it
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned := path.Clean("/" + filepath.ToSlash(key))
+	if cleaned == "/" || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+func localFileInfo(key string, info fs.FileInfo) *FileInfo {
+	return &FileInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		LastModified: info.ModTime(),
+	}
+}
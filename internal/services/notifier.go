@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Notification events
+const (
+	EventArticleReady  = "article_ready"
+	EventArticleFailed = "article_failed"
+	EventDailyBriefing = "daily_briefing"
+)
+
+// Notification channels
+const (
+	ChannelAPNs    = "apns"
+	ChannelFCM     = "fcm"
+	ChannelWebPush = "web_push"
+	ChannelEmail   = "email"
+)
+
+// NotificationEvents and NotificationChannels list every event and channel,
+// in the order preferences are shown
+var (
+	NotificationEvents   = []string{EventArticleReady, EventArticleFailed, EventDailyBriefing}
+	NotificationChannels = []string{ChannelAPNs, ChannelFCM, ChannelWebPush, ChannelEmail}
+)
+
+// ErrDeviceTokenInvalid is returned by a Notifier when a device token or
+// push subscription is unregistered or malformed; the dispatcher removes the
+// device. Errors that may be temporary or caused by configuration must not
+// wrap it.
+var ErrDeviceTokenInvalid = errors.New("device token is no longer valid")
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	// Channel returns the channel the notifier delivers on, such as ChannelAPNs
+	Channel() string
+	Notify(ctx context.Context, recipient Recipient, notification Notification) error
+}
+
+// Recipient is where a notification is delivered on a channel
+type Recipient struct {
+	// Address is the APNs or FCM device token, the Web Push subscription
+	// endpoint, or the email address
+	Address string
+	// Environment is the APNs environment that issued the token, "sandbox"
+	// for development builds or "production"; empty uses the service default
+	Environment string
+	// P256DH and Auth are the keys of a Web Push subscription
+	P256DH string
+	Auth   string
+}
+
+// Notification is a message for one user. Title, Subtitle and Body are the
+// text every channel shows; channels add what they support on top.
+type Notification struct {
+	Event    string
+	Title    string
+	Subtitle string
+	Body     string
+	Badge    int                   // the user's unread articles
+	Article  *ArticleNotification  // the article the notification is about; nil for daily briefings
+	Articles []ArticleNotification // the articles in a daily briefing
+}
+
+// ArticleNotification describes an article a notification is about
+type ArticleNotification struct {
+	ArticleID    int64
+	Title        string
+	URL          string // the original article
+	Format       string // text, audio or video
+	ThumbnailURL string // signed URL shown as rich media; empty when there is no thumbnail
+}
+
+// NewArticleReadyNotification creates the notification sent when an article is ready
+func NewArticleReadyNotification(article ArticleNotification, badge int) Notification {
+	body := "Your article is ready to read"
+	if article.Title != "" {
+		body = fmt.Sprintf("Your article '%s' is ready to read", article.Title)
+	}
+
+	return Notification{
+		Event:   EventArticleReady,
+		Title:   "Article Ready!",
+		Body:    body,
+		Badge:   badge,
+		Article: &article,
+	}
+}
+
+// NewArticleFailedNotification creates the notification sent when an article
+// fails, with the step that failed as subtitle
+func NewArticleFailedNotification(article ArticleNotification, errorMsg string, badge int) Notification {
+	body := "There was an error processing your article"
+	if article.Title != "" {
+		body = fmt.Sprintf("There was an error processing '%s'", article.Title)
+	}
+
+	return Notification{
+		Event:    EventArticleFailed,
+		Title:    "Article Processing Failed",
+		Subtitle: errorMsg,
+		Body:     body,
+		Badge:    badge,
+		Article:  &article,
+	}
+}
+
+// NewDailyBriefingNotification creates the notification listing the articles
+// that became ready since the last briefing
+func NewDailyBriefingNotification(articles []ArticleNotification, badge int) Notification {
+	titles := make([]string, 0, 3)
+	for _, article := range articles {
+		if len(titles) == cap(titles) {
+			break
+		}
+		if article.Title != "" {
+			titles = append(titles, article.Title)
+		}
+	}
+
+	body := fmt.Sprintf("%d new articles are waiting for you", len(articles))
+	if len(articles) == 1 {
+		body = "1 new article is waiting for you"
+	}
+	if len(titles) > 0 {
+		body += ": " + strings.Join(titles, ", ")
+		if len(articles) > len(titles) {
+			body += " and more"
+		}
+	}
+
+	return Notification{
+		Event:    EventDailyBriefing,
+		Title:    "Your Daily Briefing",
+		Body:     body,
+		Badge:    badge,
+		Articles: articles,
+	}
+}
+
+// NotificationPreferences says which channels each event is sent on, by
+// event and then channel
+type NotificationPreferences map[string]map[string]bool
+
+// DefaultNotificationPreferences are the preferences of a user who never
+// changed them: article updates go to every push channel, email and the
+// daily briefing are opt-in
+func DefaultNotificationPreferences() NotificationPreferences {
+	prefs := NotificationPreferences{}
+	for _, event := range NotificationEvents {
+		prefs[event] = map[string]bool{}
+		for _, channel := range NotificationChannels {
+			prefs[event][channel] = event != EventDailyBriefing && channel != ChannelEmail
+		}
+	}
+	return prefs
+}
+
+// LoadNotificationPreferences returns a user's preferences, with the
+// defaults for anything they never changed
+func LoadNotificationPreferences(ctx context.Context, db *sql.DB, userID string) (NotificationPreferences, error) {
+	prefs := DefaultNotificationPreferences()
+
+	rows, err := db.QueryContext(ctx, `SELECT event, channel, enabled FROM notification_preferences
+	                                   WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event, channel string
+		var enabled bool
+		if err := rows.Scan(&event, &channel, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		if channels, ok := prefs[event]; ok {
+			channels[channel] = enabled
+		}
+	}
+	return prefs, rows.Err()
+}
+
+// NotificationDispatcher sends a user's notifications over every channel
+// their preferences enable for the event, to each of their devices
+type NotificationDispatcher struct {
+	db        *sql.DB
+	notifiers map[string]Notifier
+}
+
+// NewNotificationDispatcher creates a dispatcher for the configured
+// notifiers; channels without a notifier are skipped
+func NewNotificationDispatcher(db *sql.DB, notifiers ...Notifier) *NotificationDispatcher {
+	byChannel := map[string]Notifier{}
+	for _, notifier := range notifiers {
+		byChannel[notifier.Channel()] = notifier
+	}
+
+	return &NotificationDispatcher{
+		db:        db,
+		notifiers: byChannel,
+	}
+}
+
+// Notify sends a notification to a user. Delivery failures are logged and
+// don't stop delivery to other recipients. Device tokens and subscriptions a
+// channel reports as no longer valid are removed.
+func (d *NotificationDispatcher) Notify(ctx context.Context, userID string, notification Notification) error {
+	prefs, err := LoadNotificationPreferences(ctx, d.db, userID)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	for _, channel := range NotificationChannels {
+		notifier, ok := d.notifiers[channel]
+		if !ok || !prefs[notification.Event][channel] {
+			continue
+		}
+
+		recipients, err := d.recipients(ctx, userID, channel)
+		if err != nil {
+			log.Printf("Failed to load %s recipients for user %s: %v", channel, userID, err)
+			continue
+		}
+
+		for _, recipient := range recipients {
+			err := notifier.Notify(ctx, recipient, notification)
+			if errors.Is(err, ErrDeviceTokenInvalid) {
+				log.Printf("Removing %s device %s: %v", channel, recipient.Address, err)
+				if _, err := d.db.ExecContext(ctx, `DELETE FROM devices WHERE token = $1`, recipient.Address); err != nil {
+					log.Printf("Failed to remove %s device %s: %v", channel, recipient.Address, err)
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to send %s notification to %s: %v", channel, recipient.Address, err)
+				continue
+			}
+			sent++
+		}
+	}
+
+	if sent == 0 {
+		log.Printf("No %s notification delivered to user %s: no enabled channel with a registered device", notification.Event, userID)
+	}
+	return nil
+}
+
+// recipients returns where a user receives notifications on a channel: the
+// devices registered for it, or the account's email address
+func (d *NotificationDispatcher) recipients(ctx context.Context, userID, channel string) ([]Recipient, error) {
+	if channel == ChannelEmail {
+		var email sql.NullString
+		err := d.db.QueryRowContext(ctx, `SELECT email FROM auth.users WHERE id = $1`, userID).Scan(&email)
+		if err == sql.ErrNoRows || (err == nil && email.String == "") {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []Recipient{{Address: email.String}}, nil
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT token, COALESCE(environment, ''), COALESCE(web_push_p256dh, ''), COALESCE(web_push_auth, '')
+	                                     FROM devices WHERE user_id = $1 AND channel = $2`, userID, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []Recipient
+	for rows.Next() {
+		var recipient Recipient
+		if err := rows.Scan(&recipient.Address, &recipient.Environment, &recipient.P256DH, &recipient.Auth); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, rows.Err()
+}
+
+// SetDeviceEnvironment stores the APNs environment a device's token belongs to
+func SetDeviceEnvironment(ctx context.Context, db *sql.DB, token, environment string) error {
+	_, err := db.ExecContext(ctx, `UPDATE devices SET environment = $1, updated_at = NOW() WHERE token = $2`, environment, token)
+	return err
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Multipart upload settings for S3Storage
+const (
+	s3UploadPartSize    = 8 * 1024 * 1024
+	s3UploadConcurrency = 3
+)
+
+// S3Config configures an S3-compatible bucket
+type S3Config struct {
+	Endpoint   string
+	Region     string
+	AccessKey  string
+	SecretKey  string
+	BucketName string
+}
+
+// S3Storage stores files in an S3-compatible bucket, such as Supabase Storage
+type S3Storage struct {
+	client     *s3.Client
+	uploader   *manager.Uploader
+	presigner  *s3.PresignClient
+	bucketName string
+	endpoint   string
+}
+
+// NewS3Storage creates a new storage service using Supabase's S3-compatible endpoint
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	// Create custom resolver for Supabase endpoint
+	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		if service == s3.ServiceID {
+			return aws.Endpoint{
+				URL:               cfg.Endpoint,
+				HostnameImmutable: true,
+				SigningRegion:     region,
+			}, nil
+		}
+		return aws.Endpoint{}, fmt.Errorf("unknown endpoint requested")
+	})
+
+	// Load AWS configuration with custom endpoint
+	awsCfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(cfg.Region),
+		config.WithEndpointResolverWithOptions(customResolver),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKey, cfg.SecretKey, "")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	// Create S3 client
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		o.UsePathStyle = true // Use path-style addressing for Supabase
+	})
+
+	// Bodies larger than one part are sent as a multipart upload, so at most
+	// s3UploadPartSize * s3UploadConcurrency bytes are held in memory
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = s3UploadPartSize
+		u.Concurrency = s3UploadConcurrency
+	})
+
+	return &S3Storage{
+		client:     client,
+		uploader:   uploader,
+		presigner:  s3.NewPresignClient(client),
+		bucketName: cfg.BucketName,
+		endpoint:   cfg.Endpoint,
+	}, nil
+}
+
+// Upload streams a file to Supabase storage, using a multipart upload for
+// large files
+func (s *S3Storage) Upload(ctx context.Context, key string, body io.Reader, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	}
+
+	_, err := s.uploader.Upload(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	return nil
+}
+
+// Download opens a file in Supabase storage for streaming
+func (s *S3Storage) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+
+	result, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return result.Body, nil
+}
+
+// DownloadRange opens part of a file in Supabase storage for streaming
+func (s *S3Storage) DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	}
+
+	result, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	return result.Body, nil
+}
+
+// Delete deletes a file from Supabase storage
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+
+	_, err := s.client.DeleteObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
+
+// Move copies a file to its new key and deletes the original, as S3 has no rename
+func (s *S3Storage) Move(ctx context.Context, src, dst string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucketName),
+		CopySource: aws.String(s.bucketName + "/" + src),
+		Key:        aws.String(dst),
+	}
+
+	if _, err := s.client.CopyObject(ctx, input); err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return ErrFileNotFound
+		}
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	return s.Delete(ctx, src)
+}
+
+// Stat returns the size, type and version of a file
+func (s *S3Storage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+
+	result, err := s.client.HeadObject(ctx, input)
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrFileNotFound
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return &FileInfo{
+		Key:          key,
+		Size:         aws.ToInt64(result.ContentLength),
+		ContentType:  aws.ToString(result.ContentType),
+		ETag:         aws.ToString(result.ETag),
+		LastModified: aws.ToTime(result.LastModified),
+	}, nil
+}
+
+// List returns the files whose keys start with prefix
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	files := []FileInfo{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, object := range page.Contents {
+			files = append(files, FileInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				ETag:         aws.ToString(object.ETag),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// SignedURL returns a presigned GET URL for a file in the private bucket
+func (s *S3Storage) SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+
+	request, err := s.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign URL: %w", err)
+	}
+
+	return request.URL, nil
+}
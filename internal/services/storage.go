@@ -1,158 +1,128 @@
 package services
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"time"
 )
 
-type StorageService struct {
-	client     *s3.Client
-	bucketName string
-	endpoint   string
-	publicURL  string
+// ErrFileNotFound is returned by Storage when a key does not exist
+var ErrFileNotFound = errors.New("file not found")
+
+// Storage stores generated media (audio, thumbnails, videos) by key
+type Storage interface {
+	// Upload streams body into key. The body is read to EOF; a read error
+	// aborts the upload.
+	Upload(ctx context.Context, key string, body io.Reader, contentType string) error
+	// Download opens a file for streaming. The caller must close it.
+	Download(ctx context.Context, key string) (io.ReadCloser, error)
+	// DownloadRange opens length bytes of a file starting at offset, or the
+	// rest of the file when length is negative. The caller must close it.
+	DownloadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// Move renames a file, replacing any file already at dst
+	Move(ctx context.Context, src, dst string) error
+	Stat(ctx context.Context, key string) (*FileInfo, error)
+	// List returns the files whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]FileInfo, error)
+	// SignedURL returns a URL that grants read access to key until ttl has passed
+	SignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
 }
 
-// NewStorageService creates a new storage service using Supabase's S3-compatible endpoint
-func NewStorageService(endpoint, publicURL, region, accessKey, secretKey, bucketName string) (*StorageService, error) {
-	// Create custom resolver for Supabase endpoint
-	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		if service == s3.ServiceID {
-			return aws.Endpoint{
-				URL:               endpoint,
-				HostnameImmutable: true,
-				SigningRegion:     region,
-			}, nil
-		}
-		return aws.Endpoint{}, fmt.Errorf("unknown endpoint requested")
-	})
-
-	// Load AWS configuration with custom endpoint
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithEndpointResolverWithOptions(customResolver),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKey, secretKey, "")),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
-
-	// Create S3 client
-	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
-		o.UsePathStyle = true // Use path-style addressing for Supabase
-	})
-
-	return &StorageService{
-		client:     client,
-		bucketName: bucketName,
-		endpoint:   endpoint,
-		publicURL:  publicURL,
-	}, nil
+// FileInfo describes a stored file
+type FileInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
 }
 
-// UploadFile uploads a file to Supabase storage
-func (s *StorageService) UploadFile(ctx context.Context, key string, data []byte, contentType string) (string, error) {
-	input := &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String(contentType),
-	}
-
-	_, err := s.client.PutObject(ctx, input)
-	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
+// NewStorage creates the storage backend selected by config: "s3" for a
+// private S3-compatible bucket such as Supabase Storage, or "local" for a
+// directory served by the /files/ route. signingSecret signs local URLs.
+func NewStorage(backend string, s3 S3Config, localRoot, localBaseURL, signingSecret string) (Storage, error) {
+	switch backend {
+	case "s3":
+		return NewS3Storage(s3)
+	case "local":
+		return NewLocalStorage(localRoot, localBaseURL, signingSecret)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
 	}
-
-	// Generate public URL
-	// https://fawgciilqoctwjwcjaqc.supabase.co/storage/v1/object/public/pocketscribe/thumbnails/article_19.png
-	publicURL := fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.publicURL, s.bucketName, key)
-	return publicURL, nil
 }
 
-// DownloadFile downloads a file from Supabase storage
-func (s *StorageService) DownloadFile(ctx context.Context, key string) ([]byte, error) {
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-	}
-
-	result, err := s.client.GetObject(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to download file: %w", err)
-	}
-	defer result.Body.Close()
+// StorageReader reads a stored file through ranged downloads. It implements
+// io.ReadSeeker, so a file can be served with http.ServeContent without
+// downloading the parts the client did not ask for.
+type StorageReader struct {
+	ctx     context.Context
+	storage Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
 
-	data, err := io.ReadAll(result.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file data: %w", err)
+// NewStorageReader creates a reader over the file at key, whose size is known from Stat
+func NewStorageReader(ctx context.Context, storage Storage, key string, size int64) *StorageReader {
+	return &StorageReader{
+		ctx:     ctx,
+		storage: storage,
+		key:     key,
+		size:    size,
 	}
-
-	return data, nil
 }
 
-// DeleteFile deletes a file from Supabase storage
-func (s *StorageService) DeleteFile(ctx context.Context, key string) error {
-	input := &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
+func (r *StorageReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
 	}
-
-	_, err := s.client.DeleteObject(ctx, input)
-	if err != nil {
-		return fmt.Errorf("failed to delete file: %w", err)
+	if r.body == nil {
+		body, err := r.storage.DownloadRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
 	}
 
-	return nil
-}
-
-// GetPublicURL returns the public URL for a file
-func (s *StorageService) GetPublicURL(key string) string {
-	return fmt.Sprintf("%s/storage/v1/object/public/%s/%s", s.publicURL, s.bucketName, key)
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
 }
 
-// GenerateAudioKey generates a storage key for an audio file
-func GenerateAudioKey(articleID int64) string {
-	return filepath.Join("audio", fmt.Sprintf("article_%d.mp3", articleID))
-}
-
-// GenerateThumbnailKey generates a storage key for a thumbnail image
-func GenerateThumbnailKey(articleID int64) string {
-	return filepath.Join("thumbnails", fmt.Sprintf("article_%d.png", articleID))
-}
-
-// GenerateVideoKey generates a storage key for a video file
-func GenerateVideoKey(articleID int64) string {
-	return filepath.Join("videos", fmt.Sprintf("article_%d.mp4", articleID))
-}
-
-// UploadVideoFile uploads a video file from local path to Supabase storage
-func (s *StorageService) UploadVideoFile(ctx context.Context, key string, localPath string) (string, error) {
-	// Read the video file
-	data, err := os.ReadFile(localPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read video file: %w", err)
+func (r *StorageReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.offset + offset
+	case io.SeekEnd:
+		target = r.size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
 	}
-
-	// Upload to storage
-	publicURL, err := s.UploadFile(ctx, key, data, "video/mp4")
-	if err != nil {
-		return "", fmt.Errorf("failed to upload video: %w", err)
+	if target < 0 {
+		return 0, fmt.Errorf("negative position %d", target)
 	}
 
-	// Clean up local file after successful upload
-	if err := os.Remove(localPath); err != nil {
-		// Log but don't fail if we can't delete the local file
-		fmt.Printf("Warning: failed to delete local video file %s: %v\n", localPath, err)
+	// Reopen the download at the new position on the next read
+	if target != r.offset {
+		r.Close()
+		r.offset = target
 	}
+	return target, nil
+}
 
-	return publicURL, nil
+// Close closes the current download, if any
+func (r *StorageReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
 }
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Storyboard is an ordered list of scenes that together narrate a summary
+type Storyboard struct {
+	VisualStyle string            `json:"visual_style"`
+	Scenes      []StoryboardScene `json:"scenes"`
+}
+
+// StoryboardScene is a single shot of a storyboarded video
+type StoryboardScene struct {
+	VisualPrompt    string `json:"visual_prompt"`
+	Narration       string `json:"narration"`
+	DurationSeconds int    `json:"duration_seconds"`
+}
+
+// storyboardSchema is the JSON schema of a Storyboard response
+var storyboardSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"visual_style": map[string]interface{}{"type": "string"},
+		"scenes": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"visual_prompt":    map[string]interface{}{"type": "string"},
+					"narration":        map[string]interface{}{"type": "string"},
+					"duration_seconds": map[string]interface{}{"type": "integer"},
+				},
+				"required": []string{"visual_prompt", "narration", "duration_seconds"},
+			},
+		},
+	},
+	"required": []string{"visual_style", "scenes"},
+}
+
+// GenerateStoryboard splits a summary into scenes, each with a visual prompt,
+// a narration line and a duration, so the video can be generated scene by scene
+func (g *GeminiService) GenerateStoryboard(summary string, totalDuration int, language string, aspectRatio string) (*Storyboard, error) {
+	languageInstruction := ""
+	if language != "" {
+		languageInstruction = fmt.Sprintf("Write the narration in language [%s]. Keep the visual prompts in English.", language)
+	}
+
+	prompt := fmt.Sprintf(`You are a video director turning an article summary into a short explainer video.
+
+Split the summary below into an ordered storyboard of scenes. The whole video should last about %d seconds.
+
+For each scene provide:
+- "visual_prompt": a vivid, self-contained description of what the camera shows, suitable for a text-to-video model. Do not include any on-screen text. %s
+- "narration": the line a voice-over reads during the scene. It must be speakable in the scene duration (about 2.5 words per second).
+- "duration_seconds": one of %s.
+
+Also provide "visual_style": one sentence describing the shared look (palette, lighting, camera style) so all scenes feel like one coherent video.
+
+Scenes must follow the order of the summary and together cover its main points. %s
+
+Respond with JSON only, in this shape:
+{"visual_style": "...", "scenes": [{"visual_prompt": "...", "narration": "...", "duration_seconds": 8}]}
+
+Summary:
+%s`, totalDuration, framingInstruction(aspectRatio), formatDurations(SoraSupportedDurations), languageInstruction, summary)
+
+	text, err := g.provider.Generate(context.Background(), g.models.Summarize, prompt, GenerateOptions{Schema: storyboardSchema})
+	if err != nil {
+		return nil, err
+	}
+
+	var storyboard Storyboard
+	if err := json.Unmarshal([]byte(text), &storyboard); err != nil {
+		return nil, fmt.Errorf("failed to parse storyboard: %w", err)
+	}
+
+	// Drop empty scenes and snap durations to what the video model accepts
+	scenes := storyboard.Scenes[:0]
+	for _, scene := range storyboard.Scenes {
+		if strings.TrimSpace(scene.VisualPrompt) == "" {
+			continue
+		}
+		scene.DurationSeconds = NearestSupportedDuration(scene.DurationSeconds)
+		scenes = append(scenes, scene)
+	}
+	if len(scenes) == 0 {
+		return nil, fmt.Errorf("storyboard has no scenes")
+	}
+	storyboard.Scenes = scenes
+
+	return &storyboard, nil
+}
+
+func formatDurations(durations []int) string {
+	parts := make([]string, len(durations))
+	for i, d := range durations {
+		parts[i] = fmt.Sprintf("%d", d)
+	}
+	return strings.Join(parts, ", ")
+}
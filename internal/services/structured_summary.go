@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// StructuredSummary is a machine-readable digest of an article, generated
+// alongside the spoken summary
+type StructuredSummary struct {
+	TLDR         string       `json:"tldr"`
+	KeyTakeaways []string     `json:"key_takeaways"`
+	Quotes       []Quote      `json:"quotes"`
+	Entities     []Entity     `json:"entities"`
+	ReadingLevel ReadingLevel `json:"reading_level"`
+}
+
+// Quote is a verbatim passage of the article. Start and End are character
+// offsets into the article's original content.
+type Quote struct {
+	Text    string `json:"text"`
+	Speaker string `json:"speaker,omitempty"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+// Entity is a named person, organization, place or thing the article mentions
+type Entity struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ReadingLevel estimates how demanding the article is to read
+type ReadingLevel struct {
+	Grade int    `json:"grade"` // US school grade, 1-18
+	Label string `json:"label"`
+}
+
+// structuredSummarySchema is the JSON schema of a StructuredSummary response.
+// Quote offsets are computed locally, so the model only returns the text.
+var structuredSummarySchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"tldr": map[string]interface{}{"type": "string"},
+		"key_takeaways": map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": "string"},
+		},
+		"quotes": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text":    map[string]interface{}{"type": "string"},
+					"speaker": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"text"},
+			},
+		},
+		"entities": map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{"type": "string"},
+					"type": map[string]interface{}{
+						"type": "string",
+						"enum": []interface{}{"person", "organization", "location", "product", "event", "other"},
+					},
+				},
+				"required": []string{"name", "type"},
+			},
+		},
+		"reading_level": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"grade": map[string]interface{}{"type": "integer", "minimum": float64(1), "maximum": float64(18)},
+				"label": map[string]interface{}{
+					"type": "string",
+					"enum": []interface{}{"elementary", "middle_school", "high_school", "college", "expert"},
+				},
+			},
+			"required": []string{"grade", "label"},
+		},
+	},
+	"required": []string{"tldr", "key_takeaways", "quotes", "entities", "reading_level"},
+}
+
+// GenerateStructuredSummary extracts a TL;DR, key takeaways, notable quotes,
+// named entities and a reading level from an article. Quotes that cannot be
+// found verbatim in the content are dropped.
+func (g *GeminiService) GenerateStructuredSummary(content string, summary string, language string) (*StructuredSummary, error) {
+	languageInstruction := ""
+	if language != "" {
+		languageInstruction = fmt.Sprintf("Write the TL;DR and key takeaways in language [%s]. ", language)
+	}
+
+	// Long articles are cut to the input budget; the spoken summary still
+	// covers the whole article for the TL;DR and takeaways
+	excerpt := content
+	if maxRunes := g.summarize.maxInputTokens() * 4; utf8.RuneCountInString(excerpt) > maxRunes {
+		excerpt = string([]rune(excerpt)[:maxRunes])
+	}
+
+	prompt := fmt.Sprintf(`Analyze the article below and return a structured summary.
+
+- "tldr": one sentence capturing the article's main point.
+- "key_takeaways": three to seven short, self-contained takeaways, most important first.
+- "quotes": up to five notable quotes. Each "text" must be copied EXACTLY, character for character, from the article content, without adding quotation marks. Include "speaker" when the article attributes the quote to someone.
+- "entities": the people, organizations, locations, products and events that matter to the article, each named once.
+- "reading_level": the US school grade needed to read the article comfortably, and the matching label.
+
+%sQuotes and entity names stay in the article's language.
+
+Summary:
+%s
+
+Article content:
+%s`, languageInstruction, summary, excerpt)
+
+	text, err := g.provider.Generate(context.Background(), g.models.Summarize, prompt, GenerateOptions{Schema: structuredSummarySchema})
+	if err != nil {
+		return nil, err
+	}
+
+	var structured StructuredSummary
+	if err := json.Unmarshal([]byte(text), &structured); err != nil {
+		return nil, fmt.Errorf("failed to parse structured summary: %w", err)
+	}
+
+	structured.Quotes = locateQuotes(content, structured.Quotes)
+	if structured.KeyTakeaways == nil {
+		structured.KeyTakeaways = []string{}
+	}
+	if structured.Entities == nil {
+		structured.Entities = []Entity{}
+	}
+
+	return &structured, nil
+}
+
+// locateQuotes sets the character offsets of each quote within content and
+// drops quotes the model did not copy verbatim
+func locateQuotes(content string, quotes []Quote) []Quote {
+	located := []Quote{}
+	for _, quote := range quotes {
+		text := strings.Trim(strings.TrimSpace(quote.Text), "\"“”")
+		if text == "" {
+			continue
+		}
+
+		i := strings.Index(content, text)
+		if i < 0 {
+			continue
+		}
+
+		quote.Text = text
+		quote.Start = utf8.RuneCountInString(content[:i])
+		quote.End = quote.Start + utf8.RuneCountInString(text)
+		located = append(located, quote)
+	}
+	return located
+}
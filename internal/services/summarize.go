@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// SummarizeOptions controls how articles that do not fit in one prompt are
+// split up and summarized
+type SummarizeOptions struct {
+	MaxInputTokens int // content above this size is summarized map-reduce style
+	ChunkTokens    int // target size of each section in the map pass
+	Concurrency    int // sections summarized at once
+}
+
+func (o SummarizeOptions) maxInputTokens() int {
+	if o.MaxInputTokens <= 0 {
+		return 100000
+	}
+	return o.MaxInputTokens
+}
+
+func (o SummarizeOptions) chunkTokens() int {
+	if o.ChunkTokens <= 0 || o.ChunkTokens > o.maxInputTokens() {
+		return o.maxInputTokens() / 4
+	}
+	return o.ChunkTokens
+}
+
+func (o SummarizeOptions) concurrency() int {
+	if o.Concurrency <= 0 {
+		return 4
+	}
+	return o.Concurrency
+}
+
+// maxReduceRounds bounds how many times section summaries are condensed again
+// before the final reduce pass
+const maxReduceRounds = 3
+
+// ArticleSummary holds the renditions of an article's summary
+type ArticleSummary struct {
+	Content string // extracted article text
+	Speech  string // plain spoken script, used for TTS and video narration
+	Display string // Markdown reading copy
+}
+
+// summaryInput is the text the final summaries are written from: the article
+// itself, or its section summaries when the article is too long
+type summaryInput struct {
+	text    string
+	merging bool
+}
+
+// summarizeContent writes the speech and reading renditions of the summary.
+// Content that fits in one prompt is summarized directly. Longer content is
+// split into sections that are summarized independently (map), and both
+// renditions are then written from the section summaries in order (reduce).
+func (g *GeminiService) summarizeContent(content string, length string, language string, style string) (speech string, display string, err error) {
+	input, err := g.prepareSummaryInput(content, length)
+	if err != nil {
+		return "", "", err
+	}
+
+	speech, err = g.generateSpeechSummary(input, length, language, style)
+	if err != nil {
+		return "", "", err
+	}
+
+	display, err = g.generateDisplaySummary(input, length, language, style)
+	if err != nil {
+		return "", "", err
+	}
+
+	return speech, display, nil
+}
+
+// prepareSummaryInput runs the map pass for content that does not fit in one
+// prompt, condensing section summaries again until they fit
+func (g *GeminiService) prepareSummaryInput(content string, length string) (summaryInput, error) {
+	if EstimateTokens(content) <= g.summarize.maxInputTokens() {
+		return summaryInput{text: content}, nil
+	}
+
+	notes := content
+	for round := 0; EstimateTokens(notes) > g.summarize.maxInputTokens(); round++ {
+		if round == maxReduceRounds {
+			return summaryInput{}, fmt.Errorf("content is still too long after %d rounds of section summaries", round)
+		}
+
+		sections := ChunkContent(notes, g.summarize.chunkTokens())
+		log.Printf("Summarizing %d sections (about %d tokens), round %d", len(sections), EstimateTokens(notes), round+1)
+
+		summaries, err := g.mapSections(sections, func(section Section) (string, error) {
+			return g.summarizeSection(section, length, len(sections))
+		})
+		if err != nil {
+			return summaryInput{}, fmt.Errorf("failed to summarize sections: %w", err)
+		}
+
+		notes = joinSectionSummaries(sections, summaries)
+	}
+
+	return summaryInput{text: notes, merging: true}, nil
+}
+
+// summarizeSection condenses one section of a longer article, keeping enough
+// detail for the reduce pass to produce the target length
+func (g *GeminiService) summarizeSection(section Section, length string, sectionCount int) (string, error) {
+	var detail string
+	switch length {
+	case "s":
+		detail = "Keep only the main points."
+	case "l":
+		detail = "Keep every point, example and figure, only remove repetition and filler."
+	default:
+		detail = "Keep the main points and the most important supporting details."
+	}
+
+	heading := ""
+	if section.Heading != "" {
+		heading = fmt.Sprintf("The section is titled \"%s\". ", section.Heading)
+	}
+
+	prompt := fmt.Sprintf(`The following text is one of %d consecutive sections of a long article. %sSummarize this section on its own. %s
+
+Write plain prose in the same language as the section, without an introduction or conclusion. Return ONLY the summary.
+
+Section:
+%s`, sectionCount, heading, detail, section.Text)
+
+	summary, err := g.provider.Generate(context.Background(), g.models.Summarize, prompt, GenerateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// generateSpeechSummary writes the summary as a script to be read aloud
+func (g *GeminiService) generateSpeechSummary(input summaryInput, length string, language string, style string) (string, error) {
+	mergeInstruction := ""
+	if input.merging {
+		mergeInstruction = `
+The article was too long to read at once, so below are summaries of its consecutive sections, in order, each under its heading. Merge them into one summary:
+- Keep the sections in their original order
+- Use each heading as a short spoken transition into its section
+- Remove repetition between sections
+`
+	}
+
+	prompt := fmt.Sprintf(`%s to %s
+%s
+IMPORTANT: This summary will be converted to speech, so:
+- Use only spoken language and natural phrasing
+- Avoid special characters, symbols, URLs, hashtags, and markdown formatting
+- Avoid parentheses, brackets, asterisks, underscores, and other punctuation marks that aren't naturally spoken
+- Use periods for natural pauses between sentences
+- Use commas for shorter pauses within sentences
+- Spell out numbers, percentages, and abbreviations (e.g., "ten percent" not "10%%", "doctor" not "Dr.")
+- Write out acronyms on first use, then use the full term
+- Use complete sentences with clear, natural flow
+- Organize with paragraph breaks (blank lines) to indicate longer pauses between topics
+- Be conversational and engaging, as if explaining to a listener
+- Return ONLY the summary text, nothing else
+
+%s:
+%s
+
+Summary:`, summaryStyleInstruction(language, style), summaryTargetLength(length), mergeInstruction, input.label(), input.text)
+
+	return g.generateSummaryText(prompt)
+}
+
+// generateDisplaySummary writes the summary as Markdown reading copy
+func (g *GeminiService) generateDisplaySummary(input summaryInput, length string, language string, style string) (string, error) {
+	mergeInstruction := ""
+	if input.merging {
+		mergeInstruction = `
+The article was too long to read at once, so below are summaries of its consecutive sections, in order, each under its heading. Merge them into one summary:
+- Keep the sections in their original order
+- Keep the section headings where they help the reader
+- Remove repetition between sections
+`
+	}
+
+	prompt := fmt.Sprintf(`%s to %s
+%s
+IMPORTANT: This summary will be read on screen, so:
+- Format it as Markdown
+- Use "##" headings to separate the main topics when the summary covers more than one
+- Use bullet or numbered lists for steps, options and groups of related points
+- Use numerals, percentages, symbols and standard abbreviations (e.g., "10%%" not "ten percent")
+- Use **bold** sparingly for key terms
+- Keep paragraphs short and scannable
+- Do not start with a title, the article title is shown separately
+- Return ONLY the Markdown summary, nothing else
+
+%s:
+%s
+
+Summary:`, summaryStyleInstruction(language, style), summaryTargetLength(length), mergeInstruction, input.label(), input.text)
+
+	return g.generateSummaryText(prompt)
+}
+
+func (g *GeminiService) generateSummaryText(prompt string) (string, error) {
+	summary, err := g.provider.Generate(context.Background(), g.models.Summarize, prompt, GenerateOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(summary), nil
+}
+
+func (in summaryInput) label() string {
+	if in.merging {
+		return "Section summaries"
+	}
+	return "Article content"
+}
+
+func summaryTargetLength(length string) string {
+	switch length {
+	case "s":
+		return "approximately 1 minute of reading time (about 150-200 words)"
+	case "m":
+		return "approximately 5 minutes of reading time (about 750-1000 words)"
+	case "l":
+		return "keep the full article content, but clean it up and organize it well"
+	default:
+		return "approximately 5 minutes of reading time"
+	}
+}
+
+func summaryStyleInstruction(language string, style string) string {
+	// Default style is summarize if not provided
+	if style == "" {
+		style = "summarize"
+	}
+
+	// Build style-specific instruction
+	styleInstruction := style
+
+	if language != "" {
+		styleInstruction += fmt.Sprintf(" In language [%s]", language)
+	}
+
+	return styleInstruction
+}
+
+// mapSections runs fn over every section with bounded parallelism and returns
+// the results in section order
+func (g *GeminiService) mapSections(sections []Section, fn func(Section) (string, error)) ([]string, error) {
+	results := make([]string, len(sections))
+	errs := make([]error, len(sections))
+	sem := make(chan struct{}, g.summarize.concurrency())
+
+	var wg sync.WaitGroup
+	for i, section := range sections {
+		wg.Add(1)
+		go func(i int, section Section) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = fn(section)
+		}(i, section)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", i+1, err)
+		}
+	}
+	return results, nil
+}
+
+// joinSectionSummaries lays out section summaries in order under their
+// headings, merging consecutive sections that share a heading
+func joinSectionSummaries(sections []Section, summaries []string) string {
+	var b strings.Builder
+	lastHeading := ""
+	for i, section := range sections {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		if section.Heading != "" && section.Heading != lastHeading {
+			fmt.Fprintf(&b, "# %s\n\n", section.Heading)
+			lastHeading = section.Heading
+		}
+		b.WriteString(summaries[i])
+	}
+	return b.String()
+}
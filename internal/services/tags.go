@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxSuggestedTags bounds how many tags are added to an article automatically
+const maxSuggestedTags = 5
+
+// SuggestTags picks the tags from the user's vocabulary that fit an article.
+// It never invents new tags, so the user's tag list stays under their control.
+func (g *GeminiService) SuggestTags(title string, summary string, vocabulary []string) ([]string, error) {
+	if len(vocabulary) == 0 {
+		return []string{}, nil
+	}
+
+	enum := make([]interface{}, len(vocabulary))
+	for i, tag := range vocabulary {
+		enum[i] = tag
+	}
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string", "enum": enum},
+			},
+		},
+		"required": []string{"tags"},
+	}
+
+	prompt := fmt.Sprintf(`Choose the tags that describe the article below. Only choose from this list of the user's existing tags:
+%s
+
+Pick at most %d tags, and only tags that clearly apply. Return an empty list if none apply.
+
+Title: %s
+
+Summary:
+%s`, strings.Join(vocabulary, "\n"), maxSuggestedTags, title, summary)
+
+	text, err := g.provider.Generate(context.Background(), g.models.Title, prompt, GenerateOptions{Schema: schema})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse tag suggestions: %w", err)
+	}
+
+	// Keep only known tags, in case the model ignored the schema
+	known := make(map[string]bool, len(vocabulary))
+	for _, tag := range vocabulary {
+		known[tag] = true
+	}
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range result.Tags {
+		if known[tag] && !seen[tag] && len(tags) < maxSuggestedTags {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// EmbeddedChunk is a passage of an article with its embedding. Start and End
+// are character offsets of the passage in the article's original content.
+type EmbeddedChunk struct {
+	Index     int
+	Text      string
+	Start     int
+	End       int
+	Embedding []float32
+}
+
+// ChunkMatch is a passage returned by a semantic search
+type ChunkMatch struct {
+	ArticleID  int64
+	Title      *string
+	URL        string
+	ChunkIndex int
+	Text       string
+	Start      int
+	End        int
+	Score      float64 // cosine similarity, higher is closer
+}
+
+// VectorIndex stores article passages with their embeddings and finds the
+// passages closest to a query vector
+type VectorIndex interface {
+	// Replace stores the chunks of an article, replacing any previous ones
+	Replace(ctx context.Context, articleID int64, chunks []EmbeddedChunk) error
+
+	// Search returns the user's passages closest to the vector, best first
+	Search(ctx context.Context, userID string, vector []float32, limit int) ([]ChunkMatch, error)
+}
+
+// NewVectorIndex picks the index for the database: pgvector when the
+// article_chunks table has a vector column (see database.EnableVectorSearch),
+// otherwise the pure-Go index. mode "memory" forces the pure-Go index.
+func NewVectorIndex(db *sql.DB, mode string) (VectorIndex, error) {
+	if mode == "memory" {
+		return NewMemoryVectorIndex(db), nil
+	}
+
+	var hasVectorColumn bool
+	query := `SELECT EXISTS (
+	          SELECT 1 FROM information_schema.columns
+	          WHERE table_name = 'article_chunks' AND column_name = 'embedding_vector')`
+	if err := db.QueryRow(query).Scan(&hasVectorColumn); err != nil {
+		return nil, fmt.Errorf("failed to detect pgvector: %w", err)
+	}
+
+	if hasVectorColumn {
+		return NewPgVectorIndex(db), nil
+	}
+	if mode == "pgvector" {
+		return nil, fmt.Errorf("pgvector is not available in this database")
+	}
+	return NewMemoryVectorIndex(db), nil
+}
+
+// PgVectorIndex searches with pgvector's HNSW index
+type PgVectorIndex struct {
+	db *sql.DB
+}
+
+func NewPgVectorIndex(db *sql.DB) *PgVectorIndex {
+	return &PgVectorIndex{db: db}
+}
+
+func (idx *PgVectorIndex) Replace(ctx context.Context, articleID int64, chunks []EmbeddedChunk) error {
+	return replaceChunks(ctx, idx.db, articleID, chunks, true)
+}
+
+func (idx *PgVectorIndex) Search(ctx context.Context, userID string, vector []float32, limit int) ([]ChunkMatch, error) {
+	query := `SELECT c.article_id, a.title, a.url, c.chunk_index, c.content, c.start_offset, c.end_offset,
+	          1 - (c.embedding_vector <=> $2::vector)
+	          FROM article_chunks c
+	          JOIN articles a ON a.id = c.article_id
+	          WHERE a.user_id = $1 AND a.deleted_at IS NULL
+	          ORDER BY c.embedding_vector <=> $2::vector
+	          LIMIT $3`
+
+	rows, err := idx.db.QueryContext(ctx, query, userID, vectorLiteral(vector), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search chunks: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []ChunkMatch{}
+	for rows.Next() {
+		var m ChunkMatch
+		if err := rows.Scan(&m.ArticleID, &m.Title, &m.URL, &m.ChunkIndex, &m.Text, &m.Start, &m.End, &m.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// MemoryVectorIndex is a pure-Go index for databases without pgvector. It
+// scans the user's stored embeddings and ranks them exactly, which is fine for
+// personal libraries of a few thousand articles.
+type MemoryVectorIndex struct {
+	db *sql.DB
+}
+
+func NewMemoryVectorIndex(db *sql.DB) *MemoryVectorIndex {
+	return &MemoryVectorIndex{db: db}
+}
+
+func (idx *MemoryVectorIndex) Replace(ctx context.Context, articleID int64, chunks []EmbeddedChunk) error {
+	return replaceChunks(ctx, idx.db, articleID, chunks, false)
+}
+
+func (idx *MemoryVectorIndex) Search(ctx context.Context, userID string, vector []float32, limit int) ([]ChunkMatch, error) {
+	query := `SELECT c.article_id, a.title, a.url, c.chunk_index, c.content, c.start_offset, c.end_offset, c.embedding
+	          FROM article_chunks c
+	          JOIN articles a ON a.id = c.article_id
+	          WHERE a.user_id = $1 AND a.deleted_at IS NULL`
+
+	rows, err := idx.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []ChunkMatch{}
+	for rows.Next() {
+		var m ChunkMatch
+		var embedding pq.Float32Array
+		if err := rows.Scan(&m.ArticleID, &m.Title, &m.URL, &m.ChunkIndex, &m.Text, &m.Start, &m.End, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		m.Score = cosineSimilarity(vector, embedding)
+		matches = append(matches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// replaceChunks swaps the stored chunks of an article in one transaction,
+// filling the pgvector column too when it exists
+func replaceChunks(ctx context.Context, db *sql.DB, articleID int64, chunks []EmbeddedChunk, withVector bool) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM article_chunks WHERE article_id = $1`, articleID); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+
+	for _, chunk := range chunks {
+		if withVector {
+			_, err = tx.ExecContext(ctx, `INSERT INTO article_chunks
+			         (article_id, chunk_index, content, start_offset, end_offset, embedding, embedding_vector)
+			         VALUES ($1, $2, $3, $4, $5, $6, $7::vector)`,
+				articleID, chunk.Index, chunk.Text, chunk.Start, chunk.End,
+				pq.Float32Array(chunk.Embedding), vectorLiteral(chunk.Embedding))
+		} else {
+			_, err = tx.ExecContext(ctx, `INSERT INTO article_chunks
+			         (article_id, chunk_index, content, start_offset, end_offset, embedding)
+			         VALUES ($1, $2, $3, $4, $5, $6)`,
+				articleID, chunk.Index, chunk.Text, chunk.Start, chunk.End,
+				pq.Float32Array(chunk.Embedding))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to insert chunk %d: %w", chunk.Index, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// vectorLiteral formats a vector in pgvector's text format
+func vectorLiteral(vector []float32) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// normalizeVector scales a vector to unit length
+func normalizeVector(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vector
+	}
+
+	norm := math.Sqrt(sum)
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+// cosineSimilarity compares two vectors, 1 meaning identical direction
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
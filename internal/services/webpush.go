@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Web Push constants (RFC 8291 message encryption, RFC 8292 VAPID)
+const (
+	webPushRecordSize     = 4096
+	webPushTTL            = 24 * time.Hour // how long the push service keeps a message for an offline browser
+	webPushVAPIDLifetime  = 12 * time.Hour
+	webPushMaxPayloadSize = 3993 // 4096 bytes minus the header, padding delimiter and tag
+)
+
+// WebPushConfig configures Web Push with VAPID
+type WebPushConfig struct {
+	// PrivateKey is the VAPID private key: the base64url encoded P-256
+	// scalar, as generated by web-push libraries
+	PrivateKey string
+	Subject    string // mailto: or https: contact for push services, e.g. mailto:ops@example.com
+
+	// WebAppURL is where the web app is served; notifications open
+	// WebAppURL/articles/42. The original article opens when it is empty.
+	WebAppURL string
+
+	Client *http.Client
+}
+
+// WebPushService sends notifications to browser push subscriptions
+type WebPushService struct {
+	key       *ecdsa.PrivateKey
+	publicKey string // base64url uncompressed point, as browsers take it in applicationServerKey
+	subject   string
+	webAppURL string
+	client    *http.Client
+}
+
+// webPushMessage is the JSON the web app's service worker shows
+type webPushMessage struct {
+	Event     string `json:"event"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	URL       string `json:"url,omitempty"`
+	ArticleID int64  `json:"article_id,omitempty"`
+	Image     string `json:"image,omitempty"`
+	Badge     int    `json:"badge"`
+	Tag       string `json:"tag,omitempty"`
+}
+
+// NewWebPushService creates a Web Push service signing with the VAPID key
+func NewWebPushService(cfg WebPushConfig) (*WebPushService, error) {
+	scalar, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cfg.PrivateKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("VAPID private key is not base64url encoded: %w", err)
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(scalar)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	// Convert to an ECDSA key for signing VAPID tokens
+	der, err := x509.MarshalPKCS8PrivateKey(ecdhKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("VAPID private key must be a P-256 key")
+	}
+
+	if cfg.Subject == "" {
+		return nil, fmt.Errorf("VAPID subject is required")
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &WebPushService{
+		key:       key,
+		publicKey: base64.RawURLEncoding.EncodeToString(ecdhKey.PublicKey().Bytes()),
+		subject:   cfg.Subject,
+		webAppURL: strings.TrimSuffix(cfg.WebAppURL, "/"),
+		client:    client,
+	}, nil
+}
+
+// PublicKey returns the VAPID public key browsers subscribe with
+func (s *WebPushService) PublicKey() string {
+	return s.publicKey
+}
+
+// Channel returns ChannelWebPush
+func (s *WebPushService) Channel() string {
+	return ChannelWebPush
+}
+
+// Notify sends an encrypted notification to a browser push subscription
+func (s *WebPushService) Notify(ctx context.Context, subscription Recipient, notification Notification) error {
+	message := webPushMessage{
+		Event: notification.Event,
+		Title: notification.Title,
+		Body:  notification.Body,
+		URL:   s.webAppURL,
+		Badge: notification.Badge,
+		Tag:   notification.Event,
+	}
+	if notification.Subtitle != "" {
+		message.Body = fmt.Sprintf("%s\n%s", notification.Subtitle, notification.Body)
+	}
+	if article := notification.Article; article != nil {
+		message.ArticleID = article.ArticleID
+		message.Image = article.ThumbnailURL
+		message.Tag = fmt.Sprintf("article-%d", article.ArticleID)
+		message.URL = article.URL
+		if s.webAppURL != "" {
+			message.URL = fmt.Sprintf("%s/articles/%d", s.webAppURL, article.ArticleID)
+		}
+	}
+
+	plaintext, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal web push message: %w", err)
+	}
+	if len(plaintext) > webPushMaxPayloadSize {
+		// Drop the image URL, the longest optional field, rather than fail
+		message.Image = ""
+		if plaintext, err = json.Marshal(message); err != nil {
+			return fmt.Errorf("failed to marshal web push message: %w", err)
+		}
+	}
+
+	body, err := encryptWebPush(subscription, plaintext)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(subscription.Address)
+	if err != nil {
+		return fmt.Errorf("%w: invalid web push endpoint: %v", ErrDeviceTokenInvalid, err)
+	}
+	vapidToken, err := signES256JWT(s.key, map[string]string{"typ": "JWT", "alg": "ES256"}, map[string]interface{}{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(webPushVAPIDLifetime).Unix(),
+		"sub": s.subject,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", subscription.Address, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", fmt.Sprintf("%d", int(webPushTTL.Seconds())))
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", vapidToken, s.publicKey))
+	if notification.Event == EventDailyBriefing {
+		req.Header.Set("Urgency", "normal")
+	} else {
+		req.Header.Set("Urgency", "high")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		log.Printf("Web Push: Failed to send notification. Status: %d", resp.StatusCode)
+
+		// The subscription expired or the user revoked permission
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+			return fmt.Errorf("%w: push service returned status %d", ErrDeviceTokenInvalid, resp.StatusCode)
+		}
+		return fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+
+	log.Printf("Web Push: Successfully sent notification to %s", endpoint.Host)
+	return nil
+}
+
+// encryptWebPush encrypts a message for a subscription as a single aes128gcm
+// record (RFC 8291): the content key and nonce are derived from an ECDH
+// secret between a fresh key pair and the subscription's p256dh key, mixed
+// with its auth secret
+func encryptWebPush(subscription Recipient, plaintext []byte) ([]byte, error) {
+	userAgentKeyBytes, err := decodeWebPushKey(subscription.P256DH)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid p256dh key: %v", ErrDeviceTokenInvalid, err)
+	}
+	userAgentKey, err := ecdh.P256().NewPublicKey(userAgentKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid p256dh key: %v", ErrDeviceTokenInvalid, err)
+	}
+	authSecret, err := decodeWebPushKey(subscription.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, fmt.Errorf("%w: invalid auth secret", ErrDeviceTokenInvalid)
+	}
+
+	serverKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate web push key: %w", err)
+	}
+	sharedSecret, err := serverKey.ECDH(userAgentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive web push secret: %w", err)
+	}
+	serverPublicKey := serverKey.PublicKey().Bytes()
+
+	keyInfo := "WebPush: info\x00" + string(userAgentKeyBytes) + string(serverPublicKey)
+	ikm, err := hkdf.Key(sha256.New, sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive web push key: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate web push salt: %w", err)
+	}
+	contentKey, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive web push key: %w", err)
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive web push nonce: %w", err)
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// Header: salt, record size, key ID length and the server public key
+	header := make([]byte, 0, 16+4+1+len(serverPublicKey))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(serverPublicKey)))
+	header = append(header, serverPublicKey...)
+
+	// The single record ends with the last-record padding delimiter
+	record := append(append([]byte{}, plaintext...), 0x02)
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// decodeWebPushKey decodes a subscription key, which browsers encode as
+// base64url with or without padding
+func decodeWebPushKey(key string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+}